@@ -0,0 +1,269 @@
+package aqylly
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyContextKey is the context key under which APIKeyAuth stores the key info
+const APIKeyContextKey = "aqylly.apikey"
+
+// API key errors
+var (
+	ErrAPIKeyMissing  = errors.New("apikey: key missing")
+	ErrAPIKeyNotFound = errors.New("apikey: key not found")
+	ErrAPIKeyExpired  = errors.New("apikey: key expired")
+)
+
+// APIKey describes the owner and permissions of an API key
+type APIKey struct {
+	Owner     string    `json:"owner"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// HasScope reports whether the key grants the scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyStore looks up API keys
+type KeyStore interface {
+	// Lookup returns the key info or ErrAPIKeyNotFound
+	Lookup(ctx context.Context, key string) (*APIKey, error)
+}
+
+// MemoryKeyStore is an in-memory KeyStore.
+// Keys are indexed by their SHA-256 digest, so plain keys are never kept in memory.
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey
+}
+
+// NewMemoryKeyStore creates an empty in-memory key store
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string]*APIKey)}
+}
+
+// Add adds or replaces a key
+func (s *MemoryKeyStore) Add(key string, info APIKey) {
+	s.mu.Lock()
+	s.keys[hashAPIKey(key)] = &info
+	s.mu.Unlock()
+}
+
+// Remove removes a key
+func (s *MemoryKeyStore) Remove(key string) {
+	s.mu.Lock()
+	delete(s.keys, hashAPIKey(key))
+	s.mu.Unlock()
+}
+
+// Lookup implements KeyStore
+func (s *MemoryKeyStore) Lookup(_ context.Context, key string) (*APIKey, error) {
+	s.mu.RLock()
+	info, ok := s.keys[hashAPIKey(key)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return info, nil
+}
+
+// replace swaps all keys at once
+func (s *MemoryKeyStore) replace(keys map[string]*APIKey) {
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+}
+
+// FileKeyStore is a KeyStore backed by a JSON file.
+//
+// The file contains an array of entries with either a plain "key" or
+// its hex-encoded "key_sha256", plus "owner", "scopes" and an optional
+// "expires_at". Call Reload to pick up changes.
+type FileKeyStore struct {
+	MemoryKeyStore
+	path string
+}
+
+// NewFileKeyStore creates a key store and loads the keys from the file
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{
+		MemoryKeyStore: MemoryKeyStore{keys: make(map[string]*APIKey)},
+		path:           path,
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the file again and replaces all keys
+func (s *FileKeyStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var entries []struct {
+		APIKey
+		Key       string `json:"key"`
+		KeySHA256 string `json:"key_sha256"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*APIKey, len(entries))
+	for i := range entries {
+		digest := strings.ToLower(entries[i].KeySHA256)
+		if entries[i].Key != "" {
+			digest = hashAPIKey(entries[i].Key)
+		}
+		if digest == "" {
+			continue
+		}
+		info := entries[i].APIKey
+		keys[digest] = &info
+	}
+
+	s.replace(keys)
+	return nil
+}
+
+// APIKeyConfig holds the configuration for the APIKeyAuth middleware
+type APIKeyConfig struct {
+	// Store looks up the keys
+	Store KeyStore
+
+	// Header is the request header carrying the key (default: "X-API-Key"
+	// when neither Query nor Cookie is set)
+	Header string
+
+	// Query is the query parameter carrying the key (optional)
+	Query string
+
+	// Cookie is the cookie carrying the key (optional)
+	Cookie string
+
+	// ErrorHandler is called when authentication fails (default: 401 JSON)
+	ErrorHandler func(c *Context, err error)
+}
+
+// APIKeyAuth returns a middleware that authenticates requests with API keys.
+// The key info is available through c.APIKey() and the owner through c.AuthUser().
+func APIKeyAuth(config APIKeyConfig) HandlerFunc {
+	if config.Store == nil {
+		panic("APIKeyAuth: Store is required")
+	}
+
+	if config.Header == "" && config.Query == "" && config.Cookie == "" {
+		config.Header = "X-API-Key"
+	}
+
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(c *Context, err error) {
+			c.AbortWithJSON(http.StatusUnauthorized, map[string]string{
+				"error": "Unauthorized",
+			})
+		}
+	}
+
+	return func(c *Context) {
+		key := ""
+		if config.Header != "" {
+			key = c.Header(config.Header)
+		}
+		if key == "" && config.Query != "" {
+			key = c.Query(config.Query)
+		}
+		if key == "" && config.Cookie != "" {
+			key, _ = c.Cookie(config.Cookie)
+		}
+
+		if key == "" {
+			config.ErrorHandler(c, ErrAPIKeyMissing)
+			c.Abort()
+			return
+		}
+
+		info, err := config.Store.Lookup(c.Context(), key)
+		if err == nil && !info.ExpiresAt.IsZero() && time.Now().After(info.ExpiresAt) {
+			err = ErrAPIKeyExpired
+		}
+		if err != nil {
+			config.ErrorHandler(c, err)
+			c.Abort()
+			return
+		}
+
+		c.Set(APIKeyContextKey, info)
+		c.Set(AuthUserKey, info.Owner)
+		c.Next()
+	}
+}
+
+// APIKey returns the key info stored by APIKeyAuth
+func (c *Context) APIKey() *APIKey {
+	if v, ok := c.Get(APIKeyContextKey); ok {
+		if info, ok := v.(*APIKey); ok {
+			return info
+		}
+	}
+	return nil
+}
+
+// RequireScopes returns a middleware that requires all of the given scopes.
+// Scopes are taken from the API key, or from the "scope" claim of a JWT.
+func RequireScopes(scopes ...string) HandlerFunc {
+	return func(c *Context) {
+		granted := make(map[string]bool)
+		if info := c.APIKey(); info != nil {
+			for _, s := range info.Scopes {
+				granted[s] = true
+			}
+		} else if claims := c.JWTClaims(); claims != nil {
+			if scope, ok := claims["scope"].(string); ok {
+				for _, s := range strings.Fields(scope) {
+					granted[s] = true
+				}
+			}
+		}
+
+		for _, scope := range scopes {
+			if !granted[scope] {
+				c.AbortWithJSON(http.StatusForbidden, map[string]string{
+					"error": "Forbidden",
+				})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// WithScopes returns a group with the same prefix whose routes require the given scopes
+func (g *RouterGroup) WithScopes(scopes ...string) *RouterGroup {
+	return g.Group("", RequireScopes(scopes...))
+}
+
+// hashAPIKey returns the hex-encoded SHA-256 digest of the key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
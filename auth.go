@@ -0,0 +1,196 @@
+package aqylly
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AuthUserKey is the context key under which authentication middleware stores the user
+const AuthUserKey = "aqylly.auth.user"
+
+// Password hash parameters used by HashPassword
+const (
+	pbkdf2Prefix     = "pbkdf2-sha256"
+	pbkdf2Iterations = 600000
+	pbkdf2SaltSize   = 16
+	pbkdf2KeySize    = 32
+)
+
+// BasicAuthConfig holds the configuration for the BasicAuth middleware
+type BasicAuthConfig struct {
+	// Accounts maps user names to passwords. A password can be stored
+	// in plain text, as "sha256:<hex digest>", or as a PBKDF2 hash
+	// produced by HashPassword.
+	Accounts map[string]string
+
+	// Validator is a custom credential check used instead of Accounts
+	Validator func(c *Context, user, password string) bool
+
+	// Realm is the authentication realm (default: "Restricted")
+	Realm string
+}
+
+// BasicAuth returns a basic authentication middleware
+func BasicAuth(username, password string) HandlerFunc {
+	return BasicAuthWithConfig(BasicAuthConfig{
+		Accounts: map[string]string{username: password},
+	})
+}
+
+// BasicAuthWithConfig returns a basic authentication middleware.
+// Credentials are compared in constant time and the authenticated
+// user is available through c.AuthUser().
+func BasicAuthWithConfig(config BasicAuthConfig) HandlerFunc {
+	if config.Accounts == nil && config.Validator == nil {
+		panic("BasicAuth: Accounts or Validator is required")
+	}
+
+	realm := config.Realm
+	if realm == "" {
+		realm = "Restricted"
+	}
+	challenge := "Basic realm=" + strconv.Quote(realm) + `, charset="UTF-8"`
+
+	validate := config.Validator
+	if validate == nil {
+		dummy := dummyHash(config.Accounts)
+		validate = func(_ *Context, user, password string) bool {
+			stored, ok := config.Accounts[user]
+			if !ok {
+				// Compare anyway so unknown users take the same time
+				checkPassword(password, dummy)
+				return false
+			}
+			return checkPassword(password, stored)
+		}
+	}
+
+	return func(c *Context) {
+		user, pass, ok := c.Request.BasicAuth()
+		if !ok || !validate(c, user, pass) {
+			c.SetHeader("WWW-Authenticate", challenge)
+			c.AbortWithJSON(http.StatusUnauthorized, map[string]string{
+				"error": "Unauthorized",
+			})
+			return
+		}
+
+		c.Set(AuthUserKey, user)
+		c.Next()
+	}
+}
+
+// AuthUser returns the user stored by authentication middleware
+func (c *Context) AuthUser() string {
+	if v, ok := c.Get(AuthUserKey); ok {
+		if user, ok := v.(string); ok {
+			return user
+		}
+	}
+	return ""
+}
+
+// HashPassword hashes a password with PBKDF2-SHA256 for use in BasicAuthConfig.Accounts
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, pbkdf2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, pbkdf2KeySize)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s$%d$%s$%s",
+		pbkdf2Prefix,
+		pbkdf2Iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// dummyHash returns a hash that unknown users are checked against. When an
+// account uses PBKDF2 it is a random PBKDF2 hash with the highest iteration
+// count and key size in use, so the check costs as much as for a real user.
+func dummyHash(accounts map[string]string) string {
+	var iterations, keySize int
+	for _, stored := range accounts {
+		if n, _, key, ok := parsePBKDF2(stored); ok && n > iterations {
+			iterations, keySize = n, len(key)
+		}
+	}
+	if iterations == 0 {
+		return "\x00"
+	}
+
+	b := make([]byte, pbkdf2SaltSize+keySize)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%s$%d$%s$%s",
+		pbkdf2Prefix,
+		iterations,
+		base64.RawStdEncoding.EncodeToString(b[:pbkdf2SaltSize]),
+		base64.RawStdEncoding.EncodeToString(b[pbkdf2SaltSize:]),
+	)
+}
+
+// parsePBKDF2 splits a hash produced by HashPassword into its parameters
+func parsePBKDF2(stored string) (iterations int, salt, key []byte, ok bool) {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 || parts[0] != pbkdf2Prefix {
+		return 0, nil, nil, false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return 0, nil, nil, false
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, false
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return 0, nil, nil, false
+	}
+	return iterations, salt, key, true
+}
+
+// checkPassword compares a password with a stored password or hash in constant time
+func checkPassword(password, stored string) bool {
+	switch {
+	case strings.HasPrefix(stored, pbkdf2Prefix+"$"):
+		iterations, salt, expected, ok := parsePBKDF2(stored)
+		if !ok {
+			return false
+		}
+		key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+		if err != nil {
+			return false
+		}
+		return subtle.ConstantTimeCompare(key, expected) == 1
+
+	case strings.HasPrefix(stored, "sha256:"):
+		expected, err := hex.DecodeString(stored[len("sha256:"):])
+		if err != nil {
+			return false
+		}
+		sum := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(sum[:], expected) == 1
+
+	default:
+		// Hash both sides so the comparison does not leak the length
+		a := sha256.Sum256([]byte(password))
+		b := sha256.Sum256([]byte(stored))
+		return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+	}
+}
@@ -0,0 +1,78 @@
+package aqylly
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// testPBKDF2 hashes a password like HashPassword with a low iteration count
+func testPBKDF2(t *testing.T, password string, iterations int) string {
+	t.Helper()
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, pbkdf2KeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", pbkdf2Prefix, iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestCheckPassword(t *testing.T) {
+	sum := sha256.Sum256([]byte("secret"))
+	hashed := testPBKDF2(t, "secret", 1000)
+
+	tests := []struct {
+		name     string
+		password string
+		stored   string
+		want     bool
+	}{
+		{"plain", "secret", "secret", true},
+		{"plain mismatch", "secret", "other", false},
+		{"sha256", "secret", "sha256:" + hex.EncodeToString(sum[:]), true},
+		{"sha256 mismatch", "other", "sha256:" + hex.EncodeToString(sum[:]), false},
+		{"pbkdf2", "secret", hashed, true},
+		{"pbkdf2 mismatch", "other", hashed, false},
+		{"pbkdf2 malformed", "secret", pbkdf2Prefix + "$x$y$z", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkPassword(tt.password, tt.stored); got != tt.want {
+				t.Errorf("checkPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDummyHash(t *testing.T) {
+	tests := []struct {
+		name       string
+		accounts   map[string]string
+		iterations int
+	}{
+		{"plain accounts", map[string]string{"alice": "secret"}, 0},
+		{"pbkdf2 account", map[string]string{"alice": "secret", "bob": testPBKDF2(t, "secret", 1000)}, 1000},
+		{"highest iterations", map[string]string{"alice": testPBKDF2(t, "a", 1000), "bob": testPBKDF2(t, "b", 2000)}, 2000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dummy := dummyHash(tt.accounts)
+			iterations, _, key, ok := parsePBKDF2(dummy)
+			if tt.iterations == 0 {
+				if ok {
+					t.Errorf("dummyHash() = %q, want no PBKDF2 hash", dummy)
+				}
+				return
+			}
+			if !ok || iterations != tt.iterations || len(key) != pbkdf2KeySize {
+				t.Errorf("dummyHash() = %q, want %d iterations and a %d-byte key", dummy, tt.iterations, pbkdf2KeySize)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package aqylly
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is passed to the error handler when a request is short-circuited
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through and tracks failures
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects requests until OpenTimeout has elapsed
+	CircuitOpen
+
+	// CircuitHalfOpen lets a limited number of probe requests through
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreakerConfig holds the configuration for the CircuitBreaker middleware
+type CircuitBreakerConfig struct {
+	// Name identifies the breaker in OnStateChange
+	Name string
+
+	// Window is the length of the rolling window failures are counted in (default: 10s)
+	Window time.Duration
+
+	// Buckets is the number of buckets the window is divided into (default: 10)
+	Buckets int
+
+	// MinRequests is the number of requests in the window before
+	// FailureRatio is evaluated (default: 20)
+	MinRequests int
+
+	// FailureRatio opens the circuit when the share of failed requests
+	// in the window reaches it (default: 0.5)
+	FailureRatio float64
+
+	// ConsecutiveFailures opens the circuit after this many failures
+	// in a row. Zero disables the check.
+	ConsecutiveFailures int
+
+	// OpenTimeout is how long the circuit stays open before probing (default: 30s)
+	OpenTimeout time.Duration
+
+	// HalfOpenProbes is the number of probe requests let through while
+	// half-open. The circuit closes once they all succeed (default: 1).
+	HalfOpenProbes int
+
+	// IsFailure reports whether a finished request counts as a failure.
+	// By default 5xx responses and panics are failures.
+	IsFailure func(c *Context) bool
+
+	// OnStateChange is called when the circuit changes state. It runs
+	// outside the breaker's lock and may call Router.Routes.
+	OnStateChange func(name string, from, to CircuitState)
+
+	// ErrorHandler is called when a request is short-circuited
+	// (default: 503 JSON). The Retry-After header is already set.
+	ErrorHandler func(c *Context, err error)
+}
+
+// circuitBucket counts the results of one slice of the rolling window
+type circuitBucket struct {
+	start    time.Time
+	success  int
+	failures int
+}
+
+// circuitBreaker holds the state of a CircuitBreaker middleware
+type circuitBreaker struct {
+	config CircuitBreakerConfig
+
+	mu          sync.Mutex
+	state       CircuitState
+	generation  uint64
+	buckets     []circuitBucket
+	consecutive int
+	openedAt    time.Time
+	probes      int
+	probeOK     int
+
+	// State changes to report once the lock is released
+	transitions []circuitTransition
+}
+
+// circuitTransition is a state change waiting to be reported
+type circuitTransition struct {
+	from, to CircuitState
+}
+
+// CircuitBreaker returns a middleware that stops calling the handlers of a
+// failing route or group. Failures are counted in a rolling window; once the
+// thresholds are reached the circuit opens and requests are answered with 503
+// and Retry-After until OpenTimeout elapses. Probe requests then decide whether
+// the circuit closes again. The state is reported by Router.Routes().
+func CircuitBreaker(config CircuitBreakerConfig) HandlerFunc {
+	if config.Window <= 0 {
+		config.Window = 10 * time.Second
+	}
+	if config.Buckets <= 0 {
+		config.Buckets = 10
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 20
+	}
+	if config.FailureRatio <= 0 {
+		config.FailureRatio = 0.5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = func(c *Context) bool {
+			return c.writer.status >= 500
+		}
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(c *Context, err error) {
+			c.AbortWithJSON(http.StatusServiceUnavailable, map[string]string{
+				"error": "Service Unavailable",
+			})
+		}
+	}
+
+	cb := &circuitBreaker{
+		config:  config,
+		buckets: make([]circuitBucket, config.Buckets),
+	}
+
+	return func(c *Context) {
+		if c.router != nil && c.route != nil {
+			if _, ok := c.router.breakers.Load(c.route); !ok {
+				c.router.breakers.LoadOrStore(c.route, cb)
+			}
+		}
+
+		generation, retryAfter, ok := cb.allow(time.Now())
+		if !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			c.SetHeader("Retry-After", strconv.Itoa(seconds))
+			config.ErrorHandler(c, ErrCircuitOpen)
+			c.Abort()
+			return
+		}
+
+		defer func() {
+			if err := recover(); err != nil {
+				cb.record(generation, false, time.Now())
+				panic(err)
+			}
+			cb.record(generation, !config.IsFailure(c), time.Now())
+		}()
+
+		c.Next()
+	}
+}
+
+// allow reports whether a request may proceed, and otherwise how long
+// the client should wait before retrying
+func (cb *circuitBreaker) allow(now time.Time) (generation uint64, retryAfter time.Duration, ok bool) {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	cb.refresh(now)
+
+	switch cb.state {
+	case CircuitOpen:
+		return cb.generation, cb.config.OpenTimeout - now.Sub(cb.openedAt), false
+	case CircuitHalfOpen:
+		if cb.probes >= cb.config.HalfOpenProbes {
+			return cb.generation, time.Second, false
+		}
+		cb.probes++
+	}
+	return cb.generation, 0, true
+}
+
+// record counts the result of a request started in the given generation
+func (cb *circuitBreaker) record(generation uint64, success bool, now time.Time) {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	cb.refresh(now)
+
+	// Results of requests started before the last state change are stale
+	if generation != cb.generation {
+		return
+	}
+
+	switch cb.state {
+	case CircuitClosed:
+		bucket := cb.bucket(now)
+		if success {
+			bucket.success++
+			cb.consecutive = 0
+			return
+		}
+		bucket.failures++
+		cb.consecutive++
+
+		if cb.config.ConsecutiveFailures > 0 && cb.consecutive >= cb.config.ConsecutiveFailures {
+			cb.setState(CircuitOpen, now)
+			return
+		}
+		total, failures := cb.counts(now)
+		if total >= cb.config.MinRequests && float64(failures) >= cb.config.FailureRatio*float64(total) {
+			cb.setState(CircuitOpen, now)
+		}
+
+	case CircuitHalfOpen:
+		if !success {
+			cb.setState(CircuitOpen, now)
+			return
+		}
+		cb.probeOK++
+		if cb.probeOK >= cb.config.HalfOpenProbes {
+			cb.setState(CircuitClosed, now)
+		}
+	}
+}
+
+// refresh moves an open circuit to half-open once OpenTimeout has elapsed
+func (cb *circuitBreaker) refresh(now time.Time) {
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.config.OpenTimeout {
+		cb.setState(CircuitHalfOpen, now)
+	}
+}
+
+// setState changes the state and starts a new generation
+func (cb *circuitBreaker) setState(state CircuitState, now time.Time) {
+	from := cb.state
+	cb.state = state
+	cb.generation++
+	cb.consecutive = 0
+	cb.probes = 0
+	cb.probeOK = 0
+
+	switch state {
+	case CircuitOpen:
+		cb.openedAt = now
+	case CircuitClosed:
+		for i := range cb.buckets {
+			cb.buckets[i] = circuitBucket{}
+		}
+	}
+
+	if cb.config.OnStateChange != nil {
+		cb.transitions = append(cb.transitions, circuitTransition{from: from, to: state})
+	}
+}
+
+// unlock releases the lock and then reports the state changes made while it
+// was held, so OnStateChange may call back into the breaker or Router.Routes
+func (cb *circuitBreaker) unlock() {
+	transitions := cb.transitions
+	cb.transitions = nil
+	cb.mu.Unlock()
+
+	for _, t := range transitions {
+		cb.config.OnStateChange(cb.config.Name, t.from, t.to)
+	}
+}
+
+// bucket returns the bucket for now, clearing it if it belongs to an older window
+func (cb *circuitBreaker) bucket(now time.Time) *circuitBucket {
+	width := cb.config.Window / time.Duration(len(cb.buckets))
+	start := now.Truncate(width)
+	bucket := &cb.buckets[(start.UnixNano()/int64(width))%int64(len(cb.buckets))]
+	if !bucket.start.Equal(start) {
+		*bucket = circuitBucket{start: start}
+	}
+	return bucket
+}
+
+// counts returns the number of requests and failures in the window
+func (cb *circuitBreaker) counts(now time.Time) (total, failures int) {
+	for _, bucket := range cb.buckets {
+		if now.Sub(bucket.start) < cb.config.Window {
+			total += bucket.success + bucket.failures
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
+
+// currentState returns the state, moving to half-open if the timeout has elapsed
+func (cb *circuitBreaker) currentState() CircuitState {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	cb.refresh(time.Now())
+	return cb.state
+}
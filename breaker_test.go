@@ -0,0 +1,209 @@
+package aqylly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a breaker that opens after two consecutive failures
+// and records its state changes
+func newTestBreaker(changes *[]string) *circuitBreaker {
+	return &circuitBreaker{
+		config: CircuitBreakerConfig{
+			Window:              10 * time.Second,
+			MinRequests:         100,
+			FailureRatio:        0.5,
+			ConsecutiveFailures: 2,
+			OpenTimeout:         30 * time.Second,
+			HalfOpenProbes:      2,
+			OnStateChange: func(name string, from, to CircuitState) {
+				*changes = append(*changes, from.String()+">"+to.String())
+			},
+		},
+		buckets: make([]circuitBucket, 10),
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	var changes []string
+	cb := newTestBreaker(&changes)
+	now := time.Unix(1700000000, 0)
+
+	// Closed: a success resets the consecutive failures
+	for _, success := range []bool{false, true, false} {
+		gen, _, ok := cb.allow(now)
+		if !ok {
+			t.Fatal("closed circuit rejected a request")
+		}
+		cb.record(gen, success, now)
+	}
+	if cb.state != CircuitClosed {
+		t.Fatalf("state = %s, want closed", cb.state)
+	}
+
+	// Closed -> open after two failures in a row
+	gen, _, _ := cb.allow(now)
+	cb.record(gen, false, now)
+	if cb.state != CircuitOpen {
+		t.Fatalf("state = %s, want open", cb.state)
+	}
+
+	// Open rejects with the remaining timeout
+	later := now.Add(10 * time.Second)
+	if _, retryAfter, ok := cb.allow(later); ok || retryAfter != 20*time.Second {
+		t.Fatalf("allow() = %v, %v, want rejected with 20s", ok, retryAfter)
+	}
+
+	// Open -> half-open after OpenTimeout; only HalfOpenProbes requests pass
+	now = now.Add(30 * time.Second)
+	probe1, _, ok1 := cb.allow(now)
+	probe2, _, ok2 := cb.allow(now)
+	_, _, ok3 := cb.allow(now)
+	if !ok1 || !ok2 || ok3 {
+		t.Fatalf("probes allowed = %v, %v, %v, want true, true, false", ok1, ok2, ok3)
+	}
+
+	// Half-open -> closed once every probe succeeds
+	cb.record(probe1, true, now)
+	if cb.state != CircuitHalfOpen {
+		t.Fatalf("state = %s, want half-open", cb.state)
+	}
+	cb.record(probe2, true, now)
+	if cb.state != CircuitClosed {
+		t.Fatalf("state = %s, want closed", cb.state)
+	}
+
+	want := []string{"closed>open", "open>half-open", "half-open>closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("changes = %v, want %v", changes, want)
+			break
+		}
+	}
+}
+
+func TestCircuitBreakerFailedProbe(t *testing.T) {
+	var changes []string
+	cb := newTestBreaker(&changes)
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 2; i++ {
+		gen, _, _ := cb.allow(now)
+		cb.record(gen, false, now)
+	}
+	now = now.Add(30 * time.Second)
+
+	probe, _, ok := cb.allow(now)
+	if !ok {
+		t.Fatal("half-open circuit rejected the probe")
+	}
+	cb.record(probe, false, now)
+	if cb.state != CircuitOpen || !cb.openedAt.Equal(now) {
+		t.Fatalf("state = %s opened at %v, want open at %v", cb.state, cb.openedAt, now)
+	}
+}
+
+func TestCircuitBreakerStaleResults(t *testing.T) {
+	var changes []string
+	cb := newTestBreaker(&changes)
+	now := time.Unix(1700000000, 0)
+
+	// A slow request starts while the circuit is closed
+	slow, _, _ := cb.allow(now)
+
+	for i := 0; i < 2; i++ {
+		gen, _, _ := cb.allow(now)
+		cb.record(gen, false, now)
+	}
+	now = now.Add(30 * time.Second)
+	probe, _, _ := cb.allow(now)
+
+	// Its failure must not reopen the half-open circuit
+	cb.record(slow, false, now)
+	if cb.state != CircuitHalfOpen {
+		t.Fatalf("state = %s, want half-open", cb.state)
+	}
+
+	// Nor may a success count as a probe
+	cb.record(slow, true, now)
+	if cb.probeOK != 0 {
+		t.Fatalf("probeOK = %d, want 0", cb.probeOK)
+	}
+
+	cb.record(probe, true, now)
+	if cb.probeOK != 1 {
+		t.Fatalf("probeOK = %d, want 1", cb.probeOK)
+	}
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	var changes []string
+	cb := newTestBreaker(&changes)
+	cb.config.ConsecutiveFailures = 0
+	cb.config.MinRequests = 4
+	now := time.Unix(1700000000, 0)
+
+	for i, success := range []bool{true, false, true} {
+		gen, _, _ := cb.allow(now)
+		cb.record(gen, success, now)
+		if cb.state != CircuitClosed {
+			t.Fatalf("request %d opened the circuit before MinRequests", i)
+		}
+	}
+	gen, _, _ := cb.allow(now)
+	cb.record(gen, false, now)
+	if cb.state != CircuitOpen {
+		t.Fatalf("state = %s, want open at a 0.5 failure ratio", cb.state)
+	}
+}
+
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	r := New()
+	done := make(chan []Route, 1)
+	reports := r.Group("/reports", CircuitBreaker(CircuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		OpenTimeout:         30 * time.Second,
+		OnStateChange: func(name string, from, to CircuitState) {
+			// Reading the routes from the callback must not deadlock
+			done <- r.Routes()
+		},
+	}))
+	reports.GET("", func(c *Context) {
+		c.String(http.StatusInternalServerError, "%s", "failed")
+	})
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reports", nil))
+		return w
+	}
+
+	finished := make(chan *httptest.ResponseRecorder, 1)
+	go func() { finished <- serve() }()
+	select {
+	case w := <-finished:
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnStateChange calling Routes deadlocked")
+	}
+
+	routes := <-done
+	if len(routes) != 1 || routes[0].CircuitState != "open" {
+		t.Errorf("routes = %+v, want the route reported open", routes)
+	}
+
+	w := serve()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want %q", got, "30")
+	}
+}
@@ -0,0 +1,655 @@
+package aqylly
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheEntry is a stored response
+type CacheEntry struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+
+	// TTL is how long the entry is fresh
+	TTL time.Duration
+
+	// StaleWhileRevalidate is how long a stale entry may be served
+	// while it is refreshed in the background
+	StaleWhileRevalidate time.Duration
+
+	// Vary is set on the entry stored under the primary key of a response
+	// with a Vary header. It lists the headers whose values select the
+	// variant; such an entry has no response of its own.
+	Vary []string
+}
+
+// size returns the approximate memory used by the entry
+func (e *CacheEntry) size() int64 {
+	n := len(e.Body)
+	for _, name := range e.Vary {
+		n += len(name)
+	}
+	for key, values := range e.Header {
+		n += len(key)
+		for _, value := range values {
+			n += len(value)
+		}
+	}
+	return int64(n)
+}
+
+// CacheStore stores cached responses. Implement it to use a shared cache.
+type CacheStore interface {
+	// Get returns the entry stored under key
+	Get(key string) (*CacheEntry, bool)
+
+	// Set stores an entry that may be dropped once ttl has elapsed
+	Set(key string, entry *CacheEntry, ttl time.Duration)
+
+	// Delete removes the entry stored under key
+	Delete(key string)
+}
+
+// MemoryCacheStore is an in-memory LRU CacheStore bounded by entry count and size
+type MemoryCacheStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	lru        *list.List
+	items      map[string]*list.Element
+}
+
+// memoryCacheItem is an element of the LRU list
+type memoryCacheItem struct {
+	key       string
+	entry     *CacheEntry
+	expiresAt time.Time
+}
+
+// NewMemoryCacheStore creates an LRU store holding at most maxEntries
+// entries and maxBytes bytes. Zero disables a limit.
+func NewMemoryCacheStore(maxEntries int, maxBytes int64) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get implements CacheStore
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*memoryCacheItem)
+	if time.Now().After(item.expiresAt) {
+		s.remove(elem)
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return item.entry, true
+}
+
+// Set implements CacheStore
+func (s *MemoryCacheStore) Set(key string, entry *CacheEntry, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		s.remove(elem)
+	}
+
+	size := entry.size()
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return
+	}
+
+	s.items[key] = s.lru.PushFront(&memoryCacheItem{
+		key:       key,
+		entry:     entry,
+		expiresAt: time.Now().Add(ttl),
+	})
+	s.bytes += size
+
+	for (s.maxEntries > 0 && s.lru.Len() > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		s.remove(s.lru.Back())
+	}
+}
+
+// Delete implements CacheStore
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		s.remove(elem)
+	}
+}
+
+// Len returns the number of stored entries
+func (s *MemoryCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// remove drops an element; the caller holds the lock
+func (s *MemoryCacheStore) remove(elem *list.Element) {
+	item := elem.Value.(*memoryCacheItem)
+	s.lru.Remove(elem)
+	delete(s.items, item.key)
+	s.bytes -= item.entry.size()
+}
+
+// CacheConfig holds the configuration for the Cache middleware
+type CacheConfig struct {
+	// Store holds the cached responses (default: 1000 entries, 64 MB in memory)
+	Store CacheStore
+
+	// TTL is used for responses without max-age, s-maxage or Expires.
+	// Zero only caches responses that declare their freshness.
+	TTL time.Duration
+
+	// MaxEntrySize is the largest body that is cached in bytes (default: 1 MB)
+	MaxEntrySize int
+
+	// KeyFunc returns the cache key of a request (default: host and request URI)
+	KeyFunc func(c *Context) string
+}
+
+// cacheCall is a response being computed for concurrent requests
+type cacheCall struct {
+	done  chan struct{}
+	key   string
+	entry *CacheEntry
+}
+
+// cacheState is shared by the requests handled by one Cache middleware
+type cacheState struct {
+	config CacheConfig
+
+	mu       sync.Mutex
+	calls    map[string]*cacheCall
+	updating map[string]bool
+}
+
+// Cache returns a middleware that caches GET and HEAD responses following
+// their Cache-Control (max-age, s-maxage, stale-while-revalidate, no-store,
+// private), Expires and Vary headers. Concurrent misses for the same key run
+// the handler once, and If-None-Match and If-Modified-Since are answered
+// with 304 from the cached entry.
+func Cache(config CacheConfig) HandlerFunc {
+	if config.Store == nil {
+		config.Store = NewMemoryCacheStore(1000, 64<<20)
+	}
+	if config.MaxEntrySize <= 0 {
+		config.MaxEntrySize = 1 << 20
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = func(c *Context) string {
+			return c.Request.Host + c.Request.URL.RequestURI()
+		}
+	}
+
+	s := &cacheState{
+		config:   config,
+		calls:    make(map[string]*cacheCall),
+		updating: make(map[string]bool),
+	}
+
+	return func(c *Context) {
+		method := c.Method()
+		if method != http.MethodGet && method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		primary := config.KeyFunc(c)
+		key, entry, ok := s.lookup(c, primary)
+		if ok {
+			age := time.Since(entry.StoredAt)
+			if age < entry.TTL {
+				serveCacheEntry(c, entry, age)
+				return
+			}
+			if age < entry.TTL+entry.StaleWhileRevalidate {
+				s.refresh(c, primary, key)
+				serveCacheEntry(c, entry, age)
+				return
+			}
+			config.Store.Delete(key)
+		}
+
+		// HEAD responses have no body to store
+		if method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		s.mu.Lock()
+		if call, ok := s.calls[key]; ok {
+			s.mu.Unlock()
+
+			select {
+			case <-call.done:
+			case <-c.Context().Done():
+				c.Abort()
+				return
+			}
+			// The response may vary on headers this request does not share
+			if call.entry != nil && varyKey(c, primary, varyHeaders(call.entry.Header)) == call.key {
+				serveCacheEntry(c, call.entry, time.Since(call.entry.StoredAt))
+				return
+			}
+			c.Next()
+			return
+		}
+		call := &cacheCall{done: make(chan struct{})}
+		s.calls[key] = call
+		s.mu.Unlock()
+
+		defer func() {
+			s.mu.Lock()
+			if s.calls[key] == call {
+				delete(s.calls, key)
+			}
+			s.mu.Unlock()
+			close(call.done)
+		}()
+
+		writer := &cacheWriter{
+			ResponseWriter: c.Writer,
+			base:           c.Writer.Header().Clone(),
+			limit:          config.MaxEntrySize,
+		}
+		c.Writer = writer
+		defer func() {
+			c.Writer = writer.ResponseWriter
+		}()
+
+		c.Next()
+
+		entry = s.entry(c, writer)
+		if entry == nil {
+			return
+		}
+		call.key = s.store(c, primary, entry)
+		call.entry = entry
+	}
+}
+
+// lookup returns the cache key of the request and the entry stored under
+// it. The key includes the headers the cached response varies on, which
+// are kept in the store under the primary key.
+func (s *cacheState) lookup(c *Context, primary string) (string, *CacheEntry, bool) {
+	entry, ok := s.config.Store.Get(primary)
+	if !ok || len(entry.Vary) == 0 {
+		return primary, entry, ok
+	}
+
+	key := varyKey(c, primary, entry.Vary)
+	entry, ok = s.config.Store.Get(key)
+	return key, entry, ok
+}
+
+// store saves an entry under the key of its variant and returns the key
+func (s *cacheState) store(c *Context, primary string, entry *CacheEntry) string {
+	ttl := entry.TTL + entry.StaleWhileRevalidate
+	vary := varyHeaders(entry.Header)
+	if len(vary) > 0 {
+		s.config.Store.Set(primary, &CacheEntry{
+			StoredAt: entry.StoredAt,
+			TTL:      entry.TTL,
+			Vary:     vary,
+		}, ttl)
+	}
+
+	key := varyKey(c, primary, vary)
+	s.config.Store.Set(key, entry, ttl)
+	return key
+}
+
+// entry builds a cache entry from a captured response, or returns nil
+// if the response must not be stored
+func (s *cacheState) entry(c *Context, w *cacheWriter) *CacheEntry {
+	if w.header == nil || w.overflow || w.flushed {
+		return nil
+	}
+
+	switch w.status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return nil
+	}
+
+	header := w.header
+	if header.Get("Set-Cookie") != "" || header.Get("Vary") == "*" {
+		return nil
+	}
+
+	// A body rendered with a per-request CSP nonce must not be shared
+	if c.CSPNonce() != "" {
+		return nil
+	}
+	for _, name := range []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only"} {
+		if strings.Contains(w.ResponseWriter.Header().Get(name), "'nonce-") {
+			return nil
+		}
+	}
+
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return nil
+	}
+	if _, ok := directives["private"]; ok {
+		return nil
+	}
+	if _, ok := directives["no-cache"]; ok {
+		return nil
+	}
+
+	// Responses to authenticated requests are only shared when allowed explicitly
+	_, public := directives["public"]
+	_, shared := directives["s-maxage"]
+	if c.Request.Header.Get("Authorization") != "" && !public && !shared {
+		return nil
+	}
+
+	ttl, ok := cacheTTL(header, directives)
+	if !ok {
+		ttl = s.config.TTL
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	entry := &CacheEntry{
+		Status:   w.status,
+		Header:   header,
+		Body:     w.body.Bytes(),
+		StoredAt: time.Now(),
+		TTL:      ttl,
+	}
+	if value, ok := directives["stale-while-revalidate"]; ok {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			entry.StaleWhileRevalidate = time.Duration(seconds) * time.Second
+		}
+	}
+	if entry.Header.Get("ETag") == "" && len(entry.Body) > 0 {
+		entry.Header.Set("ETag", hashETag(entry.Body, false))
+	}
+	return entry
+}
+
+// refresh updates a stale entry in the background. Only the handlers after
+// the Cache middleware run again, on a copy of the request, so middleware
+// such as logging and rate limiting does not see a second request.
+func (s *cacheState) refresh(c *Context, primary, key string) {
+	s.mu.Lock()
+	if s.updating[key] {
+		s.mu.Unlock()
+		return
+	}
+	s.updating[key] = true
+	s.mu.Unlock()
+
+	req := c.Request.Clone(context.WithoutCancel(c.Context()))
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+
+	rc := &Context{router: c.router}
+	rc.reset(&discardResponseWriter{header: make(http.Header)}, req)
+	for k, v := range c.Params {
+		rc.Params[k] = v
+	}
+	rc.route = c.route
+	rc.handlers = c.handlers[c.index+1:]
+
+	writer := &cacheWriter{ResponseWriter: rc.Writer, limit: s.config.MaxEntrySize}
+	rc.Writer = writer
+
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				rc.Logger().Error("cache refresh panicked", slog.Any("error", err))
+			}
+			s.mu.Lock()
+			delete(s.updating, key)
+			s.mu.Unlock()
+		}()
+
+		rc.Next()
+		if entry := s.entry(rc, writer); entry != nil {
+			s.store(rc, primary, entry)
+		}
+	}()
+}
+
+// serveCacheEntry writes a cached response, or 304 if the request's validators match.
+// Headers already set for this request, such as the request ID, are kept.
+func serveCacheEntry(c *Context, entry *CacheEntry, age time.Duration) {
+	header := c.Writer.Header()
+	for key, values := range entry.Header {
+		if _, ok := header[key]; !ok {
+			header[key] = append([]string(nil), values...)
+		}
+	}
+	header.Set("Age", strconv.Itoa(int(age.Seconds())))
+
+	if notModified(c.Request, entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")) {
+		header.Del("Content-Length")
+		header.Del("Content-Type")
+		c.Writer.WriteHeader(http.StatusNotModified)
+		c.Abort()
+		return
+	}
+
+	c.Writer.WriteHeader(entry.Status)
+	if c.Method() != http.MethodHead {
+		c.Writer.Write(entry.Body)
+	}
+	c.Abort()
+}
+
+// notModified reports whether a GET or HEAD request's If-None-Match or
+// If-Modified-Since header matches the validators of the response
+func notModified(req *http.Request, etag, lastModified string) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etag != "" && matchETag(inm, etag, true)
+	}
+
+	ims := req.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// matchETag reports whether an If-Match or If-None-Match header value matches etag,
+// using the weak comparison when weak is true and the strong comparison otherwise
+func matchETag(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if candidate == etag && !strings.HasPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCacheControl parses a Cache-Control header into lowercase directives
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+	return directives
+}
+
+// cacheTTL returns the freshness lifetime declared by a response
+func cacheTTL(header http.Header, directives map[string]string) (time.Duration, bool) {
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return 0, true
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	if value := header.Get("Expires"); value != "" {
+		expires, err := http.ParseTime(value)
+		if err != nil {
+			return 0, true
+		}
+		date := time.Now()
+		if d, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = d
+		}
+		return expires.Sub(date), true
+	}
+
+	return 0, false
+}
+
+// varyHeaders returns the canonical request header names listed in Vary
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// varyKey appends the values of the vary headers to the primary key
+func varyKey(c *Context, primary string, vary []string) string {
+	if len(vary) == 0 {
+		return primary
+	}
+
+	var b strings.Builder
+	b.WriteString(primary)
+	for _, name := range vary {
+		b.WriteString("\x00")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(c.Request.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// cacheWriter forwards a response to the client and keeps a copy of it
+type cacheWriter struct {
+	http.ResponseWriter
+	status int
+
+	// base holds the headers set before the writer was installed, which
+	// are left out of the copy because they belong to the request
+	base http.Header
+
+	header   http.Header
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+	flushed  bool
+}
+
+// WriteHeader records the status and a snapshot of the headers that
+// changed since the writer was installed
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.header == nil && code >= 200 {
+		w.status = code
+		w.header = make(http.Header)
+		for key, values := range w.ResponseWriter.Header() {
+			if !slices.Equal(values, w.base[key]) {
+				w.header[key] = slices.Clone(values)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write forwards the body and keeps a copy up to the size limit
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if w.header == nil {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if w.body.Len()+len(b) > w.limit {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher; streamed responses are not cached
+func (w *cacheWriter) Flush() {
+	w.flushed = true
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *cacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// discardResponseWriter is a ResponseWriter that drops the response
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(code int)        {}
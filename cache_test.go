@@ -0,0 +1,303 @@
+package aqylly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheVary(t *testing.T) {
+	store := NewMemoryCacheStore(3, 0)
+	calls := 0
+
+	r := New()
+	r.Use(Cache(CacheConfig{Store: store}))
+	r.GET("/greeting", func(c *Context) {
+		calls++
+		c.SetHeader("Cache-Control", "max-age=60")
+		c.SetHeader("Vary", "Accept-Language")
+		c.String(http.StatusOK, "%s", "hello "+c.Header("Accept-Language"))
+	})
+
+	tests := []struct {
+		language string
+		want     string
+		calls    int
+	}{
+		{"en", "hello en", 1},
+		{"kk", "hello kk", 2},
+		{"en", "hello en", 2},
+		{"kk", "hello kk", 2},
+		{"ru", "hello ru", 3},
+		{"ru", "hello ru", 3},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/greeting", nil)
+		req.Header.Set("Accept-Language", tt.language)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Body.String() != tt.want {
+			t.Errorf("%s: body = %q, want %q", tt.language, w.Body.String(), tt.want)
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: handler calls = %d, want %d", tt.language, calls, tt.calls)
+		}
+	}
+
+	// The Vary list is kept in the store under the primary key
+	marker, ok := store.Get("example.com/greeting")
+	if !ok || len(marker.Vary) != 1 || marker.Vary[0] != "Accept-Language" {
+		t.Errorf("primary entry = %+v, want Vary [Accept-Language]", marker)
+	}
+}
+
+func TestCacheRefresh(t *testing.T) {
+	store := NewMemoryCacheStore(0, 0)
+	var requests, calls atomic.Int32
+
+	r := New()
+	r.Use(func(c *Context) {
+		requests.Add(1)
+		c.Next()
+	})
+	r.Use(Cache(CacheConfig{Store: store}))
+	r.GET("/items/:id", func(c *Context) {
+		n := calls.Add(1)
+		c.SetHeader("Cache-Control", "max-age=60, stale-while-revalidate=60")
+		c.String(http.StatusOK, "%s", c.Param("id")+" v"+strconv.Itoa(int(n)))
+	})
+
+	get := func() string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/42", nil))
+		return w.Body.String()
+	}
+
+	if body := get(); body != "42 v1" {
+		t.Fatalf("body = %q, want %q", body, "42 v1")
+	}
+
+	// Make the entry stale
+	entry, _ := store.Get("example.com/items/42")
+	entry.StoredAt = entry.StoredAt.Add(-90 * time.Second)
+
+	if body := get(); body != "42 v1" {
+		t.Fatalf("stale body = %q, want %q", body, "42 v1")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entry, ok := store.Get("example.com/items/42"); ok && string(entry.Body) == "42 v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the stale entry was not refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if body := get(); body != "42 v2" {
+		t.Errorf("refreshed body = %q, want %q", body, "42 v2")
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("global middleware ran %d times, want 3", n)
+	}
+}
+
+func TestCacheRefreshPanic(t *testing.T) {
+	store := NewMemoryCacheStore(0, 0)
+	var calls atomic.Int32
+
+	r := New()
+	r.Use(Cache(CacheConfig{Store: store}))
+	r.GET("/", func(c *Context) {
+		if calls.Add(1) > 1 {
+			panic("refresh failed")
+		}
+		c.SetHeader("Cache-Control", "max-age=60, stale-while-revalidate=60")
+		c.String(http.StatusOK, "%s", "ok")
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	entry, _ := store.Get("example.com/")
+	entry.StoredAt = entry.StoredAt.Add(-90 * time.Second)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Body.String() != "ok" {
+		t.Fatalf("body = %q, want %q", w.Body.String(), "ok")
+	}
+
+	// The panic is recovered and the stale entry stays in the store
+	deadline := time.Now().Add(5 * time.Second)
+	for calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := store.Get("example.com/"); !ok {
+		t.Error("stale entry was dropped")
+	}
+}
+
+func TestCacheSkipsNonceAndRequestHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		secure HandlerFunc
+		cached bool
+	}{
+		{"csp nonce", SecureWithConfig(SecureConfig{ContentSecurityPolicy: "script-src 'nonce-{nonce}'"}), false},
+		{"static csp", SecureWithConfig(SecureConfig{ContentSecurityPolicy: "default-src 'self'"}), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryCacheStore(0, 0)
+			calls := 0
+
+			r := New()
+			r.Use(RequestID(), tt.secure, Cache(CacheConfig{Store: store}))
+			r.GET("/page", func(c *Context) {
+				calls++
+				c.SetHeader("Cache-Control", "max-age=60")
+				c.HTML(http.StatusOK, `<script nonce="`+c.CSPNonce()+`"></script>`)
+			})
+
+			var ids []string
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+				ids = append(ids, w.Header().Get("X-Request-ID"))
+
+				if nonce := w.Header().Get("Content-Security-Policy"); strings.Contains(nonce, "nonce-") {
+					want := `nonce="` + strings.TrimSuffix(strings.TrimPrefix(nonce, "script-src 'nonce-"), "'") + `"`
+					if !strings.Contains(w.Body.String(), want) {
+						t.Fatalf("request %d: body %q does not use the header nonce %q", i, w.Body.String(), nonce)
+					}
+				}
+			}
+
+			if want := map[bool]int{true: 1, false: 2}[tt.cached]; calls != want {
+				t.Errorf("handler calls = %d, want %d", calls, want)
+			}
+			if ids[0] == ids[1] {
+				t.Errorf("both responses carry request ID %q", ids[0])
+			}
+
+			// Headers set before Cache ran belong to the request, not the response
+			if entry, ok := store.Get("example.com/page"); ok {
+				for _, name := range []string{"X-Request-Id", "Content-Security-Policy"} {
+					if entry.Header.Get(name) != "" {
+						t.Errorf("cached entry stores %s", name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCacheCollapsesConcurrentMisses(t *testing.T) {
+	var calls atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	r := New()
+	r.Use(Cache(CacheConfig{}))
+	r.GET("/slow", func(c *Context) {
+		if calls.Add(1) == 1 {
+			close(entered)
+		}
+		<-release
+		c.SetHeader("Cache-Control", "max-age=60")
+		c.String(http.StatusOK, "%s", "done")
+	})
+
+	const followers = 5
+	results := make(chan *httptest.ResponseRecorder, followers+1)
+	serve := func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		results <- w
+	}
+
+	go serve()
+	<-entered
+	for i := 0; i < followers; i++ {
+		go serve()
+	}
+	// Let the followers reach the in-flight call before it completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for i := 0; i <= followers; i++ {
+		w := <-results
+		if w.Code != http.StatusOK || w.Body.String() != "done" {
+			t.Errorf("response %d = %d %q", i, w.Code, w.Body.String())
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler calls = %d, want 1", n)
+	}
+}
+
+func TestCacheNotModified(t *testing.T) {
+	calls := 0
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	r := New()
+	r.Use(Cache(CacheConfig{}))
+	r.GET("/doc", func(c *Context) {
+		calls++
+		c.SetHeader("Cache-Control", "max-age=60")
+		c.SetHeader("Last-Modified", modified.Format(http.TimeFormat))
+		c.String(http.StatusOK, "%s", "document")
+	})
+
+	// The ETag is added to the stored entry, so the first cache hit carries it
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/doc", nil))
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("cached response has no ETag")
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"if-none-match", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"if-none-match weak", map[string]string{"If-None-Match": "W/" + etag}, http.StatusNotModified},
+		{"if-none-match differs", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"if-modified-since", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, http.StatusNotModified},
+		{"if-modified-since older", map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 has a body: %q", w.Body.String())
+			}
+		})
+	}
+
+	if calls != 1 {
+		t.Errorf("handler calls = %d, want 1", calls)
+	}
+}
@@ -0,0 +1,309 @@
+package aqylly
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Errors passed to the ConcurrencyLimit error handler
+var (
+	ErrConcurrencyLimit = errors.New("concurrency limit reached")
+	ErrQueueTimeout     = errors.New("timed out waiting for a concurrency slot")
+	ErrQueueEvicted     = errors.New("evicted from the queue by a higher priority request")
+)
+
+// Priority orders queued requests; higher priorities are served first
+type Priority int
+
+// Priority classes
+const (
+	PriorityLow      Priority = -1
+	PriorityNormal   Priority = 0
+	PriorityHigh     Priority = 1
+	PriorityCritical Priority = 2
+)
+
+// LimitAlgorithm selects how the concurrency limit adapts to load
+type LimitAlgorithm int
+
+const (
+	// LimitFixed keeps the configured limit
+	LimitFixed LimitAlgorithm = iota
+
+	// LimitAIMD grows the limit additively while latency stays below
+	// LatencyTarget and shrinks it multiplicatively when it does not
+	LimitAIMD
+
+	// LimitGradient adjusts the limit by the ratio of the long-term
+	// latency to the latest sample
+	LimitGradient
+)
+
+// ConcurrencyConfig holds the configuration for a ConcurrencyLimiter
+type ConcurrencyConfig struct {
+	// Limit is the maximum number of requests served at once.
+	// With an adaptive algorithm it is the initial limit.
+	Limit int
+
+	// QueueSize is the number of requests that may wait for a slot.
+	// Zero rejects requests as soon as the limit is reached.
+	QueueSize int
+
+	// QueueTimeout is how long a request may wait for a slot (default: 1s)
+	QueueTimeout time.Duration
+
+	// Algorithm selects a fixed or adaptive limit (default: LimitFixed)
+	Algorithm LimitAlgorithm
+
+	// MinLimit and MaxLimit bound an adaptive limit (default: 1 and 10 * Limit)
+	MinLimit int
+	MaxLimit int
+
+	// LatencyTarget is the latency above which LimitAIMD backs off (default: 100ms)
+	LatencyTarget time.Duration
+
+	// BackoffRatio is the factor LimitAIMD multiplies the limit by when it backs off (default: 0.9)
+	BackoffRatio float64
+
+	// ErrorHandler is called when a request is rejected (default: 503 JSON)
+	ErrorHandler func(c *Context, err error)
+}
+
+// waiter states
+const (
+	waiterQueued = iota
+	waiterGranted
+	waiterEvicted
+)
+
+// waiter is a request queued for a slot
+type waiter struct {
+	priority Priority
+	state    int
+	ready    chan struct{}
+}
+
+// ConcurrencyLimiter bounds the number of requests served at once.
+// One limiter can be shared by several groups with different priorities.
+type ConcurrencyLimiter struct {
+	config ConcurrencyConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	queue    []*waiter
+	longRTT  float64
+}
+
+// NewConcurrencyLimiter creates a concurrency limiter
+func NewConcurrencyLimiter(config ConcurrencyConfig) *ConcurrencyLimiter {
+	if config.Limit <= 0 {
+		panic("ConcurrencyLimiter: Limit must be positive")
+	}
+	if config.QueueTimeout <= 0 {
+		config.QueueTimeout = time.Second
+	}
+	if config.MinLimit <= 0 {
+		config.MinLimit = 1
+	}
+	if config.MaxLimit <= 0 {
+		config.MaxLimit = 10 * config.Limit
+	}
+	if config.LatencyTarget <= 0 {
+		config.LatencyTarget = 100 * time.Millisecond
+	}
+	if config.BackoffRatio <= 0 || config.BackoffRatio >= 1 {
+		config.BackoffRatio = 0.9
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(c *Context, err error) {
+			c.AbortWithJSON(http.StatusServiceUnavailable, map[string]string{
+				"error": "Service Unavailable",
+			})
+		}
+	}
+
+	return &ConcurrencyLimiter{
+		config: config,
+		limit:  float64(config.Limit),
+	}
+}
+
+// ConcurrencyLimit returns a middleware that serves at most n requests at once
+func ConcurrencyLimit(n int) HandlerFunc {
+	return NewConcurrencyLimiter(ConcurrencyConfig{Limit: n}).Middleware(PriorityNormal)
+}
+
+// ConcurrencyLimitWithConfig returns a middleware that limits concurrent requests
+func ConcurrencyLimitWithConfig(config ConcurrencyConfig) HandlerFunc {
+	return NewConcurrencyLimiter(config).Middleware(PriorityNormal)
+}
+
+// Middleware returns a middleware that takes a slot from the limiter, waiting
+// in the queue with the given priority when the limit is reached
+func (l *ConcurrencyLimiter) Middleware(priority Priority) HandlerFunc {
+	return func(c *Context) {
+		if err := l.acquire(c, priority); err != nil {
+			l.config.ErrorHandler(c, err)
+			c.Abort()
+			return
+		}
+
+		start := time.Now()
+		defer func() {
+			l.release(time.Since(start))
+		}()
+
+		c.Next()
+	}
+}
+
+// Limit returns the current concurrency limit
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of requests being served
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// acquire takes a slot, waiting in the queue if needed
+func (l *ConcurrencyLimiter) acquire(c *Context, priority Priority) error {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && len(l.queue) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+
+	if l.config.QueueSize <= 0 {
+		l.mu.Unlock()
+		return ErrConcurrencyLimit
+	}
+
+	if len(l.queue) >= l.config.QueueSize {
+		// The queue is ordered by priority, so the last waiter is the one to evict
+		last := l.queue[len(l.queue)-1]
+		if last.priority >= priority {
+			l.mu.Unlock()
+			return ErrConcurrencyLimit
+		}
+		l.queue = l.queue[:len(l.queue)-1]
+		last.state = waiterEvicted
+		close(last.ready)
+	}
+
+	w := &waiter{priority: priority, ready: make(chan struct{})}
+	i := sort.Search(len(l.queue), func(i int) bool {
+		return l.queue[i].priority < priority
+	})
+	l.queue = append(l.queue, nil)
+	copy(l.queue[i+1:], l.queue[i:])
+	l.queue[i] = w
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.config.QueueTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.ready:
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-c.Context().Done():
+		err = c.Context().Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch w.state {
+	case waiterGranted:
+		return nil
+	case waiterEvicted:
+		return ErrQueueEvicted
+	}
+
+	for i, queued := range l.queue {
+		if queued == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			break
+		}
+	}
+	return err
+}
+
+// release frees a slot, adapts the limit and hands slots to queued requests
+func (l *ConcurrencyLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.adapt(latency)
+	l.inFlight--
+
+	for len(l.queue) > 0 && l.inFlight < int(l.limit) {
+		w := l.queue[0]
+		l.queue = l.queue[1:]
+		w.state = waiterGranted
+		close(w.ready)
+		l.inFlight++
+	}
+}
+
+// adapt updates an adaptive limit with a latency sample
+func (l *ConcurrencyLimiter) adapt(latency time.Duration) {
+	sample := latency.Seconds()
+
+	switch l.config.Algorithm {
+	case LimitAIMD:
+		if latency > l.config.LatencyTarget {
+			l.limit *= l.config.BackoffRatio
+		} else if float64(l.inFlight) >= l.limit/2 {
+			// Only grow while the limit is actually being used
+			l.limit += 1 / l.limit
+		}
+
+	case LimitGradient:
+		if sample <= 0 {
+			return
+		}
+		if l.longRTT == 0 {
+			l.longRTT = sample
+		} else {
+			l.longRTT += (sample - l.longRTT) / 600
+		}
+
+		// Allow the sample to be 2x the long-term latency before shrinking
+		gradient := math.Max(0.5, math.Min(1, 2*l.longRTT/sample))
+		if gradient >= 1 && float64(l.inFlight) < l.limit/2 {
+			// Only grow while the limit is actually being used
+			return
+		}
+		target := l.limit*gradient + math.Sqrt(l.limit)
+		l.limit = 0.8*l.limit + 0.2*target
+
+		// Let the long-term latency recover after a sustained change
+		if l.longRTT/sample > 2 {
+			l.longRTT *= 0.95
+		}
+
+	default:
+		return
+	}
+
+	l.clamp()
+}
+
+// clamp keeps the limit within MinLimit and MaxLimit
+func (l *ConcurrencyLimiter) clamp() {
+	l.limit = math.Max(float64(l.config.MinLimit), math.Min(float64(l.config.MaxLimit), l.limit))
+}
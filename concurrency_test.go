@@ -0,0 +1,207 @@
+package aqylly
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// limiterContext returns a Context that only carries ctx, for calling acquire directly
+func limiterContext(ctx context.Context) *Context {
+	return &Context{ctx: ctx}
+}
+
+// waitQueued waits until n requests are queued
+func waitQueued(t *testing.T, l *ConcurrencyLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		l.mu.Lock()
+		queued := len(l.queue)
+		l.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued = %d, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimiterPriority(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Limit: 1, QueueSize: 2, QueueTimeout: time.Second})
+	if err := l.acquire(limiterContext(context.Background()), PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, 3)
+	queue := func(name string, priority Priority) {
+		go func() {
+			err := l.acquire(limiterContext(context.Background()), priority)
+			results <- result{name, err}
+		}()
+	}
+
+	queue("low", PriorityLow)
+	waitQueued(t, l, 1)
+	queue("normal", PriorityNormal)
+	waitQueued(t, l, 2)
+
+	// The queue is full, so the high priority request evicts the low one
+	queue("high", PriorityHigh)
+	if got := <-results; got.name != "low" || !errors.Is(got.err, ErrQueueEvicted) {
+		t.Fatalf("got %s %v, want low evicted", got.name, got.err)
+	}
+	waitQueued(t, l, 2)
+
+	// An equal priority request cannot evict anyone
+	if err := l.acquire(limiterContext(context.Background()), PriorityNormal); !errors.Is(err, ErrConcurrencyLimit) {
+		t.Fatalf("err = %v, want %v", err, ErrConcurrencyLimit)
+	}
+
+	for _, want := range []string{"high", "normal"} {
+		l.release(time.Millisecond)
+		if got := <-results; got.name != want || got.err != nil {
+			t.Fatalf("got %s %v, want %s granted", got.name, got.err, want)
+		}
+	}
+
+	l.release(time.Millisecond)
+	if got := l.InFlight(); got != 0 {
+		t.Errorf("InFlight = %d, want 0", got)
+	}
+}
+
+func TestConcurrencyLimiterQueueExit(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		wantErr error
+	}{
+		{"queue timeout", 20 * time.Millisecond, false, ErrQueueTimeout},
+		{"context cancelled", time.Second, true, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewConcurrencyLimiter(ConcurrencyConfig{Limit: 1, QueueSize: 1, QueueTimeout: tt.timeout})
+			if err := l.acquire(limiterContext(context.Background()), PriorityNormal); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errc := make(chan error, 1)
+			go func() {
+				errc <- l.acquire(limiterContext(ctx), PriorityNormal)
+			}()
+			waitQueued(t, l, 1)
+			if tt.cancel {
+				cancel()
+			}
+
+			if err := <-errc; !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			waitQueued(t, l, 0)
+
+			// The slot is not handed to the request that left the queue
+			l.release(time.Millisecond)
+			if got := l.InFlight(); got != 0 {
+				t.Errorf("InFlight = %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiterClamp(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm LimitAlgorithm
+		latency   time.Duration
+		want      int
+	}{
+		{"aimd grows to max", LimitAIMD, time.Millisecond, 6},
+		{"aimd shrinks to min", LimitAIMD, time.Second, 2},
+		{"gradient grows to max", LimitGradient, 10 * time.Millisecond, 6},
+		{"fixed", LimitFixed, time.Second, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewConcurrencyLimiter(ConcurrencyConfig{
+				Limit:     4,
+				MinLimit:  2,
+				MaxLimit:  6,
+				Algorithm: tt.algorithm,
+			})
+			for i := 0; i < 1000; i++ {
+				// Keep the limit in use so that it may grow
+				l.inFlight = l.Limit()
+				l.adapt(tt.latency)
+			}
+
+			if got := l.Limit(); got != tt.want {
+				t.Errorf("Limit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiterGradientShrinks(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Limit: 20, MinLimit: 8, Algorithm: LimitGradient})
+	l.adapt(10 * time.Millisecond)
+	for i := 0; i < 200; i++ {
+		l.adapt(time.Second)
+	}
+
+	if got := l.Limit(); got != 8 {
+		t.Errorf("Limit = %d, want 8", got)
+	}
+}
+
+func TestConcurrencyLimitRejects(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	r := New()
+	r.Use(ConcurrencyLimit(1))
+	r.GET("/", func(c *Context) {
+		if c.Query("block") != "" {
+			close(started)
+			<-release
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?block=1", nil))
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	close(release)
+	<-done
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
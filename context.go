@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -17,6 +18,9 @@ type Context struct {
 	Writer  http.ResponseWriter
 	Request *http.Request
 
+	// Router that is serving the request
+	router *Router
+
 	// Context for cancellation, timeouts, and values
 	ctx context.Context
 
@@ -32,29 +36,49 @@ type Context struct {
 	// Handlers chain (middleware + final handler)
 	handlers []HandlerFunc
 
-	// Status code
-	statusCode int
+	// Writer wrapper recording status code and response size
+	writer responseWriter
+
+	// Registered route that matched the request
+	route *Route
+
+	// Attributes added to the request logger
+	logAttrs []slog.Attr
+
+	// Methods registered for the request path (OPTIONS requests only)
+	allowed []string
 }
 
 // HandlerFunc defines the handler used by middleware and routes
 type HandlerFunc func(*Context)
 
-// newContext creates a new Context
-func newContext(w http.ResponseWriter, r *http.Request) *Context {
-	ctx := r.Context()
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	return &Context{
-		Writer:     w,
-		Request:    r,
-		ctx:        ctx,
-		Params:     make(map[string]string),
-		index:      -1,
-		statusCode: http.StatusOK,
+// WrapHandler adapts an http.Handler to a HandlerFunc
+func WrapHandler(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Request)
 	}
 }
 
+// WrapHandlerFunc adapts an http.HandlerFunc to a HandlerFunc
+func WrapHandlerFunc(f http.HandlerFunc) HandlerFunc {
+	return WrapHandler(f)
+}
+
+// reset prepares a pooled Context for a new request
+func (c *Context) reset(w http.ResponseWriter, r *http.Request) {
+	c.writer.reset(w)
+	c.Writer = &c.writer
+	c.Request = r
+	c.ctx = r.Context()
+	c.Params = make(map[string]string)
+	c.index = -1
+	c.handlers = nil
+	c.queryCache = nil
+	c.route = nil
+	c.logAttrs = nil
+	c.allowed = nil
+}
+
 // Next executes the next handler in the chain
 func (c *Context) Next() {
 	c.index++
@@ -132,7 +156,6 @@ func (c *Context) SetHeader(key, value string) {
 
 // Status sets the HTTP status code
 func (c *Context) Status(code int) *Context {
-	c.statusCode = code
 	c.Writer.WriteHeader(code)
 	return c
 }
@@ -190,33 +213,26 @@ func (c *Context) Path() string {
 	return c.Request.URL.Path
 }
 
-// FullPath returns the full request URL
+// FullPath returns the registered route pattern that matched the request
+// (e.g. /users/:id), or an empty string if no route matched
 func (c *Context) FullPath() string {
-	return c.Request.URL.String()
-}
-
-// ClientIP returns the client IP address
-func (c *Context) ClientIP() string {
-	// Check X-Forwarded-For header
-	if ip := c.Header("X-Forwarded-For"); ip != "" {
-		// X-Forwarded-For can contain multiple IPs, get the first one
-		if index := strings.Index(ip, ","); index != -1 {
-			return strings.TrimSpace(ip[:index])
-		}
-		return ip
-	}
+	return c.Route()
+}
 
-	// Check X-Real-IP header
-	if ip := c.Header("X-Real-IP"); ip != "" {
-		return ip
+// Route returns the registered route pattern that matched the request (e.g. /users/:id)
+func (c *Context) Route() string {
+	if c.route == nil {
+		return ""
 	}
+	return c.route.Path
+}
 
-	// Fall back to RemoteAddr
-	if index := strings.LastIndex(c.Request.RemoteAddr, ":"); index != -1 {
-		return c.Request.RemoteAddr[:index]
+// RouteName returns the name of the route that matched the request
+func (c *Context) RouteName() string {
+	if c.route == nil {
+		return ""
 	}
-
-	return c.Request.RemoteAddr
+	return c.route.Name
 }
 
 // ContentType returns the Content-Type header
@@ -360,11 +376,20 @@ func (c *Context) AbortWithJSON(code int, obj interface{}) {
 	c.JSON(code, obj)
 }
 
-// Error sends an error response
+// Error sends an error response including the request ID, if any,
+// and records the error on the active trace span
 func (c *Context) Error(code int, err error) error {
-	return c.JSON(code, map[string]string{
+	if span := c.Span(); span != nil {
+		span.RecordError(err)
+	}
+
+	response := map[string]string{
 		"error": err.Error(),
-	})
+	}
+	if requestID := c.RequestID(); requestID != "" {
+		response["request_id"] = requestID
+	}
+	return c.JSON(code, response)
 }
 
 // Push initiates an HTTP/2 server push
@@ -0,0 +1,237 @@
+package aqylly
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig holds the configuration for the CORS middleware
+type CORSConfig struct {
+	// AllowOrigins is a list of origins that may access the resource.
+	// An entry may be "*" to allow any origin, an exact origin such as
+	// "https://example.com", or a pattern with a single '*' wildcard
+	// such as "https://*.example.com" to allow all subdomains.
+	AllowOrigins []string
+
+	// AllowOriginFunc is a custom predicate used to validate the origin.
+	// It is consulted when the origin does not match AllowOrigins.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowMethods is a list of methods allowed in preflight requests.
+	// When empty, the methods registered for the requested path are used.
+	AllowMethods []string
+
+	// AllowHeaders is a list of request headers allowed in preflight requests.
+	// When empty, the headers requested by the client are reflected.
+	// "*" allows any header.
+	AllowHeaders []string
+
+	// ExposeHeaders is a list of response headers exposed to the client
+	ExposeHeaders []string
+
+	// AllowCredentials indicates whether the request can include user credentials.
+	// It cannot be combined with the "*" origin.
+	AllowCredentials bool
+
+	// MaxAge indicates how long the results of a preflight request can be cached
+	MaxAge time.Duration
+
+	// AllowPrivateNetwork answers Private Network Access preflight requests
+	AllowPrivateNetwork bool
+}
+
+// originPattern is a compiled entry of CORSConfig.AllowOrigins
+type originPattern struct {
+	prefix   string
+	suffix   string
+	wildcard bool
+}
+
+// match reports whether the origin matches the pattern
+func (p originPattern) match(origin string) bool {
+	if !p.wildcard {
+		return origin == p.prefix
+	}
+	return len(origin) > len(p.prefix)+len(p.suffix) &&
+		strings.HasPrefix(origin, p.prefix) &&
+		strings.HasSuffix(origin, p.suffix)
+}
+
+// CORS returns a middleware that handles CORS.
+// Credentials are allowed only when explicit origins are given.
+func CORS(allowOrigins, allowMethods, allowHeaders []string) HandlerFunc {
+	allowCredentials := true
+	for _, origin := range allowOrigins {
+		if origin == "*" {
+			allowCredentials = false
+			break
+		}
+	}
+
+	return CORSWithConfig(CORSConfig{
+		AllowOrigins:     allowOrigins,
+		AllowMethods:     allowMethods,
+		AllowHeaders:     allowHeaders,
+		AllowCredentials: allowCredentials,
+	})
+}
+
+// CORSWithConfig returns a middleware that handles CORS according to the Fetch spec.
+// Preflight requests are answered directly; other requests continue down the chain.
+// Automatically handled OPTIONS requests run the global middleware and the middleware
+// of the group that registered the path, so it can be used with Router.Use or a group.
+func CORSWithConfig(config CORSConfig) HandlerFunc {
+	allowAll := false
+	patterns := make([]originPattern, 0, len(config.AllowOrigins))
+	for _, origin := range config.AllowOrigins {
+		if origin == "*" {
+			allowAll = true
+			continue
+		}
+
+		origin = strings.ToLower(origin)
+		if i := strings.IndexByte(origin, '*'); i != -1 {
+			patterns = append(patterns, originPattern{
+				prefix:   origin[:i],
+				suffix:   origin[i+1:],
+				wildcard: true,
+			})
+		} else {
+			patterns = append(patterns, originPattern{prefix: origin})
+		}
+	}
+
+	if allowAll && config.AllowCredentials {
+		panic("CORS: AllowCredentials cannot be used with the '*' origin")
+	}
+
+	allowMethods := joinSlice(config.AllowMethods)
+	exposeHeaders := joinSlice(config.ExposeHeaders)
+
+	allowAnyHeader := false
+	allowedHeaders := make(map[string]bool, len(config.AllowHeaders))
+	for _, header := range config.AllowHeaders {
+		if header == "*" {
+			allowAnyHeader = true
+		}
+		allowedHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	maxAge := ""
+	if config.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(config.MaxAge / time.Second))
+	}
+
+	isOriginAllowed := func(origin string) bool {
+		if allowAll {
+			return true
+		}
+		lower := strings.ToLower(origin)
+		for _, pattern := range patterns {
+			if pattern.match(lower) {
+				return true
+			}
+		}
+		return config.AllowOriginFunc != nil && config.AllowOriginFunc(origin)
+	}
+
+	return func(c *Context) {
+		origin := c.Header("Origin")
+		preflight := c.Method() == http.MethodOptions && c.Header("Access-Control-Request-Method") != ""
+
+		header := c.Writer.Header()
+		if !allowAll {
+			header.Add("Vary", "Origin")
+		}
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		// Not a CORS request
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		if !isOriginAllowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if allowAll {
+			c.SetHeader("Access-Control-Allow-Origin", "*")
+		} else {
+			c.SetHeader("Access-Control-Allow-Origin", origin)
+		}
+		if config.AllowCredentials {
+			c.SetHeader("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				c.SetHeader("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		// Preflight: validate the requested method
+		requestMethod := strings.ToUpper(c.Header("Access-Control-Request-Method"))
+		methods := allowMethods
+		if methods == "" {
+			methods = joinSlice(c.allowed)
+		}
+		if !containsToken(methods, requestMethod) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		// Validate the requested headers
+		requestHeaders := c.Header("Access-Control-Request-Headers")
+		if requestHeaders != "" {
+			switch {
+			case len(allowedHeaders) == 0:
+				c.SetHeader("Access-Control-Allow-Headers", requestHeaders)
+			case allowAnyHeader && !config.AllowCredentials:
+				c.SetHeader("Access-Control-Allow-Headers", "*")
+			case allowAnyHeader:
+				c.SetHeader("Access-Control-Allow-Headers", requestHeaders)
+			default:
+				for _, h := range strings.Split(requestHeaders, ",") {
+					if !allowedHeaders[http.CanonicalHeaderKey(strings.TrimSpace(h))] {
+						c.AbortWithStatus(http.StatusForbidden)
+						return
+					}
+				}
+				c.SetHeader("Access-Control-Allow-Headers", joinSlice(config.AllowHeaders))
+			}
+		}
+
+		c.SetHeader("Access-Control-Allow-Methods", methods)
+		if maxAge != "" {
+			c.SetHeader("Access-Control-Max-Age", maxAge)
+		}
+		if config.AllowPrivateNetwork && c.Header("Access-Control-Request-Private-Network") == "true" {
+			c.SetHeader("Access-Control-Allow-Private-Network", "true")
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// containsToken reports whether a comma-separated list contains the token
+func containsToken(list, token string) bool {
+	for _, item := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(item), token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package aqylly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	r := New()
+	r.Use(CORSWithConfig(CORSConfig{
+		AllowOrigins:        []string{"https://example.com", "https://*.example.org"},
+		AllowHeaders:        []string{"Content-Type", "X-Token"},
+		ExposeHeaders:       []string{"X-Total"},
+		AllowCredentials:    true,
+		MaxAge:              time.Hour,
+		AllowPrivateNetwork: true,
+	}))
+	r.GET("/items", func(c *Context) { c.String(http.StatusOK, "ok") })
+	r.POST("/items", func(c *Context) { c.String(http.StatusCreated, "ok") })
+
+	tests := []struct {
+		name           string
+		method         string
+		origin         string
+		requestMethod  string
+		requestHeaders string
+		privateNetwork string
+		wantStatus     int
+		wantOrigin     string
+		wantHeaders    map[string]string
+	}{
+		{
+			name:       "no origin",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "exact origin",
+			method:     http.MethodGet,
+			origin:     "https://example.com",
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://example.com",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Total",
+			},
+		},
+		{
+			name:       "wildcard subdomain",
+			method:     http.MethodGet,
+			origin:     "https://api.example.org",
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://api.example.org",
+		},
+		{
+			name:       "wildcard needs a subdomain",
+			method:     http.MethodGet,
+			origin:     "https://.example.org",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wildcard suffix",
+			method:     http.MethodGet,
+			origin:     "https://api.example.org.evil.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "preflight disallowed origin",
+			method:        http.MethodOptions,
+			origin:        "https://evil.com",
+			requestMethod: http.MethodPost,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:           "preflight",
+			method:         http.MethodOptions,
+			origin:         "https://example.com",
+			requestMethod:  http.MethodPost,
+			requestHeaders: "content-type, x-token",
+			wantStatus:     http.StatusNoContent,
+			wantOrigin:     "https://example.com",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type, X-Token",
+				"Access-Control-Max-Age":       "3600",
+			},
+		},
+		{
+			name:          "preflight method not registered",
+			method:        http.MethodOptions,
+			origin:        "https://example.com",
+			requestMethod: http.MethodDelete,
+			wantStatus:    http.StatusForbidden,
+			wantOrigin:    "https://example.com",
+		},
+		{
+			name:           "preflight header not allowed",
+			method:         http.MethodOptions,
+			origin:         "https://example.com",
+			requestMethod:  http.MethodPost,
+			requestHeaders: "X-Other",
+			wantStatus:     http.StatusForbidden,
+			wantOrigin:     "https://example.com",
+		},
+		{
+			name:           "private network",
+			method:         http.MethodOptions,
+			origin:         "https://example.com",
+			requestMethod:  http.MethodGet,
+			privateNetwork: "true",
+			wantStatus:     http.StatusNoContent,
+			wantOrigin:     "https://example.com",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Private-Network": "true",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/items", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			if tt.requestHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+			if tt.privateNetwork != "" {
+				req.Header.Set("Access-Control-Request-Private-Network", tt.privateNetwork)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			for key, want := range tt.wantHeaders {
+				if got := w.Header().Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+
+			vary := strings.Join(w.Header().Values("Vary"), ", ")
+			if !strings.Contains(vary, "Origin") {
+				t.Errorf("Vary = %q, want Origin", vary)
+			}
+			if tt.method == http.MethodOptions && !strings.Contains(vary, "Access-Control-Request-Method") {
+				t.Errorf("Vary = %q, want Access-Control-Request-Method", vary)
+			}
+		})
+	}
+}
+
+func TestCORSAllowAll(t *testing.T) {
+	r := New()
+	r.Use(CORS([]string{"*"}, nil, nil))
+	r.GET("/items", func(c *Context) { c.String(http.StatusOK, "ok") })
+
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Origin", "https://any.example")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want empty", got)
+	}
+	if got := w.Header().Get("Vary"); got != "" {
+		t.Errorf("Vary = %q, want empty", got)
+	}
+}
+
+func TestCORSCredentialsWithWildcard(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for AllowCredentials with the '*' origin")
+		}
+	}()
+
+	CORSWithConfig(CORSConfig{
+		AllowOrigins:     []string{"*"},
+		AllowCredentials: true,
+	})
+}
+
+func TestCORSGroupPreflight(t *testing.T) {
+	r := New()
+	api := r.Group("/api", CORSWithConfig(CORSConfig{
+		AllowOrigins: []string{"https://example.com"},
+	}))
+	api.PUT("/items/:id", func(c *Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/public", func(c *Context) { c.String(http.StatusOK, "ok") })
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantOrigin string
+	}{
+		{"group route", "/api/items/1", http.StatusNoContent, "https://example.com"},
+		{"route outside the group", "/public", http.StatusNoContent, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			req.Header.Set("Origin", "https://example.com")
+			req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+		})
+	}
+}
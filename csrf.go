@@ -0,0 +1,342 @@
+package aqylly
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CSRFTokenKey is the context key under which the CSRF middleware stores the token
+const CSRFTokenKey = "aqylly.csrf.token"
+
+// CSRFTokenStore stores synchronizer tokens per session
+type CSRFTokenStore interface {
+	// Get returns the token of the session
+	Get(sessionID string) (string, bool)
+
+	// Set stores the token of the session
+	Set(sessionID, token string)
+
+	// Delete removes the token of the session, such as on logout
+	Delete(sessionID string)
+}
+
+// MemoryCSRFStore is an in-memory CSRFTokenStore. Tokens expire when
+// they have not been used for the TTL.
+type MemoryCSRFStore struct {
+	mu        sync.Mutex
+	tokens    map[string]memoryCSRFToken
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+// memoryCSRFToken is a token with its expiry
+type memoryCSRFToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// NewMemoryCSRFStore creates an empty in-memory token store whose tokens
+// expire after ttl without use (default: 24h)
+func NewMemoryCSRFStore(ttl time.Duration) *MemoryCSRFStore {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &MemoryCSRFStore{
+		tokens:    make(map[string]memoryCSRFToken),
+		ttl:       ttl,
+		lastSweep: time.Now(),
+	}
+}
+
+// Get implements CSRFTokenStore
+func (s *MemoryCSRFStore) Get(sessionID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := s.tokens[sessionID]
+	if !ok || !now.Before(entry.expiresAt) {
+		return "", false
+	}
+	entry.expiresAt = now.Add(s.ttl)
+	s.tokens[sessionID] = entry
+	return entry.token, true
+}
+
+// Set implements CSRFTokenStore
+func (s *MemoryCSRFStore) Set(sessionID, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.tokens[sessionID] = memoryCSRFToken{token: token, expiresAt: now.Add(s.ttl)}
+
+	// Drop expired tokens once per TTL so the sweep stays amortised
+	if now.Sub(s.lastSweep) >= s.ttl {
+		for id, entry := range s.tokens {
+			if !now.Before(entry.expiresAt) {
+				delete(s.tokens, id)
+			}
+		}
+		s.lastSweep = now
+	}
+}
+
+// Delete implements CSRFTokenStore
+func (s *MemoryCSRFStore) Delete(sessionID string) {
+	s.mu.Lock()
+	delete(s.tokens, sessionID)
+	s.mu.Unlock()
+}
+
+// CSRFConfig holds the configuration for the CSRF middleware.
+//
+// By default the double-submit cookie pattern is used: the token is
+// issued in a cookie and must be echoed in a header or form field.
+// When Store and SessionID are set, the synchronizer token pattern is
+// used instead and the token is kept on the server. Requests without a
+// session then use the cookie when Secret is set and are rejected otherwise.
+type CSRFConfig struct {
+	// Secret signs cookie tokens so that only tokens issued by the server
+	// are accepted (required unless Store is set). The signature is not
+	// bound to a session, so a sibling subdomain can still plant a token it
+	// obtained from the server; use Store and SessionID to prevent that.
+	Secret []byte
+
+	// Store keeps synchronizer tokens (optional)
+	Store CSRFTokenStore
+
+	// SessionID returns the session of the request, or "" when there is none
+	// (required with Store)
+	SessionID func(c *Context) string
+
+	// CookieName is the name of the token cookie (default: "_csrf")
+	CookieName string
+
+	// CookiePath is the path of the token cookie (default: "/")
+	CookiePath string
+
+	// CookieDomain is the domain of the token cookie
+	CookieDomain string
+
+	// CookieMaxAge is the max age of the token cookie in seconds (default: 86400)
+	CookieMaxAge int
+
+	// CookieSecure marks the token cookie as secure
+	CookieSecure bool
+
+	// CookieHTTPOnly hides the token cookie from scripts
+	CookieHTTPOnly bool
+
+	// CookieSameSite is the SameSite attribute of the token cookie (default: Lax)
+	CookieSameSite http.SameSite
+
+	// HeaderName is the request header carrying the token (default: "X-CSRF-Token")
+	HeaderName string
+
+	// FormField is the form field carrying the token (default: "_csrf")
+	FormField string
+
+	// TrustedOrigins lists additional origins allowed to send unsafe requests
+	TrustedOrigins []string
+
+	// ExemptPaths lists paths that are not checked.
+	// A trailing '*' matches any path with the given prefix.
+	ExemptPaths []string
+
+	// ErrorHandler is called when validation fails (default: 403 JSON)
+	ErrorHandler func(c *Context)
+}
+
+// CSRF returns a middleware that protects unsafe methods against cross-site request forgery.
+// The current token is available through c.CSRFToken().
+func CSRF(config CSRFConfig) HandlerFunc {
+	if config.Store != nil && config.SessionID == nil {
+		panic("CSRF: SessionID is required with Store")
+	}
+	if config.Store == nil && len(config.Secret) == 0 {
+		panic("CSRF: Secret is required for double-submit cookies")
+	}
+	if config.CookieName == "" {
+		config.CookieName = "_csrf"
+	}
+	if config.CookiePath == "" {
+		config.CookiePath = "/"
+	}
+	if config.CookieMaxAge == 0 {
+		config.CookieMaxAge = 86400
+	}
+	if config.CookieSameSite == 0 {
+		config.CookieSameSite = http.SameSiteLaxMode
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = "X-CSRF-Token"
+	}
+	if config.FormField == "" {
+		config.FormField = "_csrf"
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(c *Context) {
+			c.AbortWithJSON(http.StatusForbidden, map[string]string{
+				"error": "Invalid CSRF token",
+			})
+		}
+	}
+
+	trusted := make(map[string]bool, len(config.TrustedOrigins))
+	for _, origin := range config.TrustedOrigins {
+		trusted[strings.ToLower(origin)] = true
+	}
+
+	return func(c *Context) {
+		token := config.token(c)
+		c.Set(CSRFTokenKey, token)
+
+		if isSafeMethod(c.Method()) || matchPath(config.ExemptPaths, c.Path()) {
+			c.Next()
+			return
+		}
+
+		if !checkOrigin(c, trusted) {
+			config.ErrorHandler(c)
+			c.Abort()
+			return
+		}
+
+		sent := c.Header(config.HeaderName)
+		if sent == "" {
+			sent = c.PostForm(config.FormField)
+		}
+		if token == "" || sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			config.ErrorHandler(c)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CSRFToken returns the CSRF token of the request for use in templates and forms
+func (c *Context) CSRFToken() string {
+	if v, ok := c.Get(CSRFTokenKey); ok {
+		if token, ok := v.(string); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+// token returns the current token of the request, issuing a new one if
+// needed. It returns "" when no token can be issued.
+func (config *CSRFConfig) token(c *Context) string {
+	if config.Store != nil {
+		if sessionID := config.SessionID(c); sessionID != "" {
+			if token, ok := config.Store.Get(sessionID); ok {
+				return token
+			}
+			token := config.newToken()
+			config.Store.Set(sessionID, token)
+			return token
+		}
+
+		// Without a session only a signed cookie can carry the token
+		if len(config.Secret) == 0 {
+			return ""
+		}
+	}
+
+	if token, err := c.Cookie(config.CookieName); err == nil && config.validToken(token) {
+		return token
+	}
+
+	token := config.newToken()
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     config.CookieName,
+		Value:    token,
+		MaxAge:   config.CookieMaxAge,
+		Path:     config.CookiePath,
+		Domain:   config.CookieDomain,
+		Secure:   config.CookieSecure,
+		HttpOnly: config.CookieHTTPOnly,
+		SameSite: config.CookieSameSite,
+	})
+	return token
+}
+
+// newToken generates a random token, signed when a secret is configured
+func (config *CSRFConfig) newToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if len(config.Secret) > 0 {
+		token += "." + config.sign(token)
+	}
+	return token
+}
+
+// validToken checks the signature of a cookie token
+func (config *CSRFConfig) validToken(token string) bool {
+	value, signature, ok := strings.Cut(token, ".")
+	return ok && hmac.Equal([]byte(signature), []byte(config.sign(value)))
+}
+
+// sign returns the HMAC signature of a token value
+func (config *CSRFConfig) sign(value string) string {
+	mac := hmac.New(sha256.New, config.Secret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkOrigin rejects cross-site requests using Sec-Fetch-Site and Origin
+func checkOrigin(c *Context, trusted map[string]bool) bool {
+	origin := c.Header("Origin")
+	if origin != "" && origin != "null" {
+		if trusted[strings.ToLower(origin)] {
+			return true
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, c.Host())
+	}
+
+	switch c.Header("Sec-Fetch-Site") {
+	case "cross-site", "same-site":
+		return false
+	}
+
+	return origin == ""
+}
+
+// isSafeMethod reports whether the method is safe (RFC 9110)
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// matchPath reports whether the path matches any pattern.
+// A trailing '*' matches any path with the given prefix.
+func matchPath(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(path, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if pattern == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package aqylly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// csrfRouter returns a router that answers GET /token with the CSRF token
+// and POST /submit and /webhooks/* with 200
+func csrfRouter(config CSRFConfig) *Router {
+	r := New()
+	r.Use(CSRF(config))
+	r.GET("/token", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.CSRFToken())
+	})
+	ok := func(c *Context) {
+		c.String(http.StatusOK, "%s", "ok")
+	}
+	r.POST("/submit", ok)
+	r.POST("/webhooks/github", ok)
+	return r
+}
+
+// csrfCookie returns the token cookie set by the response
+func csrfCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "_csrf" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	r := csrfRouter(CSRFConfig{
+		Secret:      []byte("secret"),
+		ExemptPaths: []string{"/webhooks/*"},
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/token", nil))
+	cookie := csrfCookie(w)
+	if cookie == nil {
+		t.Fatal("no token cookie was issued")
+	}
+	token := w.Body.String()
+	if cookie.Value != token {
+		t.Fatalf("cookie %q does not match token %q", cookie.Value, token)
+	}
+
+	forged := strings.Repeat("A", 43)
+	form := url.Values{"_csrf": {token}}.Encode()
+
+	tests := []struct {
+		name   string
+		path   string
+		cookie string
+		header map[string]string
+		form   string
+		want   int
+	}{
+		{"header", "/submit", token, map[string]string{"X-CSRF-Token": token}, "", http.StatusOK},
+		{"form field", "/submit", token, nil, form, http.StatusOK},
+		{"same origin", "/submit", token, map[string]string{"X-CSRF-Token": token, "Origin": "http://example.com"}, "", http.StatusOK},
+		{"missing token", "/submit", token, nil, "", http.StatusForbidden},
+		{"wrong token", "/submit", token, map[string]string{"X-CSRF-Token": "wrong"}, "", http.StatusForbidden},
+		{"missing cookie", "/submit", "", map[string]string{"X-CSRF-Token": token}, "", http.StatusForbidden},
+		{"unsigned cookie", "/submit", forged, map[string]string{"X-CSRF-Token": forged}, "", http.StatusForbidden},
+		{"cross origin", "/submit", token, map[string]string{"X-CSRF-Token": token, "Origin": "https://evil.example"}, "", http.StatusForbidden},
+		{"cross site fetch", "/submit", token, map[string]string{"X-CSRF-Token": token, "Sec-Fetch-Site": "cross-site"}, "", http.StatusForbidden},
+		{"exempt path", "/webhooks/github", "", nil, "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.form))
+			if tt.form != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "_csrf", Value: tt.cookie})
+			}
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFSynchronizer(t *testing.T) {
+	sessionID := func(c *Context) string {
+		return c.Header("X-Session")
+	}
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		session string
+		token   func(session, other string) string
+		want    int
+	}{
+		{"own token", nil, "alice", func(session, other string) string { return session }, http.StatusOK},
+		{"other session's token", nil, "alice", func(session, other string) string { return other }, http.StatusForbidden},
+		{"no token", nil, "alice", func(session, other string) string { return "" }, http.StatusForbidden},
+		{"no session without secret", nil, "", func(session, other string) string { return session }, http.StatusForbidden},
+		{"no session with secret", []byte("secret"), "", func(session, other string) string { return session }, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryCSRFStore(0)
+			r := csrfRouter(CSRFConfig{Store: store, SessionID: sessionID, Secret: tt.secret})
+
+			fetch := func(session string) (string, *http.Cookie) {
+				req := httptest.NewRequest(http.MethodGet, "/token", nil)
+				req.Header.Set("X-Session", session)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				return w.Body.String(), csrfCookie(w)
+			}
+
+			token, cookie := fetch(tt.session)
+			other, _ := fetch("bob")
+			if tt.session != "" && cookie != nil {
+				t.Fatal("a cookie was issued for a session")
+			}
+			if again, _ := fetch(tt.session); tt.session != "" && again != token {
+				t.Fatalf("token changed from %q to %q", token, again)
+			}
+			if _, ok := store.Get(""); ok {
+				t.Fatal("a token was stored for the empty session")
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/submit", nil)
+			req.Header.Set("X-Session", tt.session)
+			if sent := tt.token(token, other); sent != "" {
+				req.Header.Set("X-CSRF-Token", sent)
+			}
+			if cookie != nil {
+				req.AddCookie(cookie)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCSRFStoreDelete(t *testing.T) {
+	store := NewMemoryCSRFStore(0)
+	store.Set("alice", "token")
+	if token, ok := store.Get("alice"); !ok || token != "token" {
+		t.Fatalf("Get = %q, %v", token, ok)
+	}
+
+	store.Delete("alice")
+	if _, ok := store.Get("alice"); ok {
+		t.Fatal("token survived Delete")
+	}
+}
+
+func TestCSRFConfigPanics(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CSRFConfig
+	}{
+		{"double submit without secret", CSRFConfig{}},
+		{"store without session", CSRFConfig{Store: NewMemoryCSRFStore(0)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("CSRF did not panic")
+				}
+			}()
+			CSRF(tt.config)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package aqylly
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Debug registers debugging endpoints under prefix, behind the given
+// middleware (use it for authentication):
+//
+//	prefix/pprof/   net/http/pprof profiles
+//	prefix/vars     expvar variables
+//	prefix/routes   registered routes
+//	prefix/runtime  goroutine count, memory statistics and scheduler settings
+//	prefix/build    build information of the binary
+//	prefix/http2    HTTP/2 settings
+//
+// The endpoints expose internals and should never be public.
+func (r *Router) Debug(prefix string, middleware ...HandlerFunc) {
+	g := r.Group(prefix, middleware...)
+
+	g.GET("/pprof", func(c *Context) {
+		c.Redirect(http.StatusMovedPermanently, c.Path()+"/")
+	})
+	g.GET("/pprof/*name", servePprof)
+	g.POST("/pprof/*name", servePprof)
+
+	g.GET("/vars", WrapHandler(expvar.Handler()))
+
+	g.GET("/routes", func(c *Context) {
+		c.JSON(http.StatusOK, r.Routes())
+	})
+
+	g.GET("/runtime", func(c *Context) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"go_version": runtime.Version(),
+			"goos":       runtime.GOOS,
+			"goarch":     runtime.GOARCH,
+			"num_cpu":    runtime.NumCPU(),
+			"gomaxprocs": runtime.GOMAXPROCS(0),
+			"goroutines": runtime.NumGoroutine(),
+			"memory": map[string]interface{}{
+				"alloc_bytes":       mem.Alloc,
+				"total_alloc_bytes": mem.TotalAlloc,
+				"sys_bytes":         mem.Sys,
+				"heap_objects":      mem.HeapObjects,
+				"num_gc":            mem.NumGC,
+				"pause_total_ns":    mem.PauseTotalNs,
+			},
+		})
+	})
+
+	g.GET("/build", func(c *Context) {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			c.JSON(http.StatusNotFound, map[string]string{
+				"error": "build information is not available",
+			})
+			return
+		}
+
+		settings := make(map[string]string, len(info.Settings))
+		for _, setting := range info.Settings {
+			settings[setting.Key] = setting.Value
+		}
+		deps := make([]map[string]string, 0, len(info.Deps))
+		for _, dep := range info.Deps {
+			module := map[string]string{"path": dep.Path, "version": dep.Version}
+			if dep.Replace != nil {
+				module["replace"] = dep.Replace.Path + "@" + dep.Replace.Version
+			}
+			deps = append(deps, module)
+		}
+
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"go_version": info.GoVersion,
+			"path":       info.Path,
+			"main":       map[string]string{"path": info.Main.Path, "version": info.Main.Version},
+			"settings":   settings,
+			"deps":       deps,
+		})
+	})
+
+	g.GET("/http2", func(c *Context) {
+		config := r.HTTP2Config
+		if config == nil {
+			config = DefaultHTTP2Config()
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"enabled":                          r.EnableHTTP2,
+			"max_concurrent_streams":           config.MaxConcurrentStreams,
+			"max_read_frame_size":              config.MaxReadFrameSize,
+			"idle_timeout_seconds":             config.IdleTimeout,
+			"max_upload_buffer_per_connection": config.MaxUploadBufferPerConnection,
+			"max_upload_buffer_per_stream":     config.MaxUploadBufferPerStream,
+		})
+	})
+}
+
+// servePprof dispatches to the net/http/pprof handlers. The index and named
+// profiles expect the request path to start with /debug/pprof/, so the path
+// is rewritten for prefixes other than /debug.
+func servePprof(c *Context) {
+	name := strings.TrimPrefix(c.Param("name"), "/")
+
+	switch name {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		req := c.Request.Clone(c.Request.Context())
+		req.URL.Path = "/debug/pprof/" + name
+		pprof.Index(c.Writer, req)
+	}
+}
@@ -0,0 +1,241 @@
+package aqylly
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETagConfig holds the configuration for the ETag middleware
+type ETagConfig struct {
+	// Weak generates weak ETags (W/"...")
+	Weak bool
+
+	// MaxBodySize is the largest body that is buffered and hashed (default: 1 MB).
+	// Larger responses are streamed without an ETag.
+	MaxBodySize int
+}
+
+// ETag returns a middleware that adds a strong ETag to GET and HEAD responses
+func ETag() HandlerFunc {
+	return ETagWithConfig(ETagConfig{})
+}
+
+// ETagWithConfig returns a middleware that buffers successful GET and HEAD
+// responses, adds an ETag hashed from the body unless the handler set one,
+// and answers matching conditional requests with 304 or 412
+func ETagWithConfig(config ETagConfig) HandlerFunc {
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1 << 20
+	}
+
+	return func(c *Context) {
+		if c.Method() != http.MethodGet && c.Method() != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer, limit: config.MaxBodySize}
+		c.Writer = writer
+		defer func() {
+			c.Writer = writer.ResponseWriter
+		}()
+
+		c.Next()
+
+		if writer.streaming {
+			return
+		}
+
+		header := writer.Header()
+		if writer.status == http.StatusOK && header.Get("ETag") == "" && writer.body.Len() > 0 {
+			header.Set("ETag", hashETag(writer.body.Bytes(), config.Weak))
+		}
+
+		if writer.status == http.StatusOK {
+			c.Writer = writer.ResponseWriter
+			if status := c.checkPreconditions(); status != 0 {
+				c.writePrecondition(status)
+				return
+			}
+		}
+
+		writer.flush()
+	}
+}
+
+// ETag sets the ETag header of the response and evaluates the request's
+// preconditions against it. It returns true when a 304 or 412 response was
+// sent and the handler should return. Unquoted values are quoted; pass
+// W/"..." for a weak ETag.
+func (c *Context) ETag(etag string) bool {
+	if !strings.HasPrefix(etag, `"`) && !strings.HasPrefix(etag, `W/"`) {
+		etag = `"` + etag + `"`
+	}
+	c.SetHeader("ETag", etag)
+
+	if status := c.checkPreconditions(); status != 0 {
+		c.writePrecondition(status)
+		return true
+	}
+	return false
+}
+
+// LastModified sets the Last-Modified header of the response and evaluates
+// the request's preconditions against it. It returns true when a 304 or 412
+// response was sent and the handler should return. When the resource also
+// has an ETag, call ETag first: without one a request with If-Match fails.
+func (c *Context) LastModified(t time.Time) bool {
+	c.SetHeader("Last-Modified", t.UTC().Format(http.TimeFormat))
+
+	if status := c.checkPreconditions(); status != 0 {
+		c.writePrecondition(status)
+		return true
+	}
+	return false
+}
+
+// checkPreconditions evaluates the conditional request headers against the
+// ETag and Last-Modified response headers in the order of RFC 9110 section
+// 13.2.2. It returns 304, 412 or 0 if the request should proceed. If-Match
+// fails without an ETag unless it is "*", except under the ETag middleware,
+// which evaluates the request again once the ETag is known.
+func (c *Context) checkPreconditions() int {
+	header := c.Writer.Header()
+	etag := header.Get("ETag")
+	var lastModified time.Time
+	if value := header.Get("Last-Modified"); value != "" {
+		lastModified, _ = http.ParseTime(value)
+	}
+
+	req := c.Request.Header
+	safe := c.Method() == http.MethodGet || c.Method() == http.MethodHead
+
+	// Step 1 and 2: If-Match, otherwise If-Unmodified-Since
+	if ifMatch := req.Get("If-Match"); ifMatch != "" {
+		if etag == "" {
+			if _, pending := c.Writer.(*bufferedWriter); !pending && strings.TrimSpace(ifMatch) != "*" {
+				return http.StatusPreconditionFailed
+			}
+		} else if !matchETag(ifMatch, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius := req.Get("If-Unmodified-Since"); ius != "" && !lastModified.IsZero() {
+		if since, err := http.ParseTime(ius); err == nil && lastModified.After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	// Step 3 and 4: If-None-Match, otherwise If-Modified-Since for GET and HEAD
+	if inm := req.Get("If-None-Match"); inm != "" {
+		if etag != "" && matchETag(inm, etag, true) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims := req.Get("If-Modified-Since"); ims != "" && safe && !lastModified.IsZero() {
+		if since, err := http.ParseTime(ims); err == nil && !lastModified.After(since) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// writePrecondition sends a 304 or 412 response and aborts the chain
+func (c *Context) writePrecondition(status int) {
+	if status == http.StatusNotModified {
+		header := c.Writer.Header()
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		c.Writer.WriteHeader(http.StatusNotModified)
+		c.Abort()
+		return
+	}
+
+	c.AbortWithJSON(http.StatusPreconditionFailed, map[string]string{
+		"error": "Precondition Failed",
+	})
+}
+
+// hashETag returns an ETag derived from the body
+func hashETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// bufferedWriter holds back the response until the handler returns.
+// It switches to streaming when the body grows past the limit or is flushed.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	limit     int
+	streaming bool
+}
+
+// WriteHeader records the status; informational responses are sent right away
+func (w *bufferedWriter) WriteHeader(code int) {
+	if w.streaming {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code >= 100 && code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+// Write buffers the body, or forwards it once the writer is streaming
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.body.Len()+len(b) > w.limit {
+		w.flush()
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// Flush implements http.Flusher by switching to streaming
+func (w *bufferedWriter) Flush() {
+	w.flush()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// flush writes the buffered response and switches to streaming
+func (w *bufferedWriter) flush() {
+	if w.streaming {
+		return
+	}
+	w.streaming = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *bufferedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,109 @@
+package aqylly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name         string
+		method       string
+		header       map[string]string
+		etag         string
+		lastModified time.Time
+		want         int
+	}{
+		{"no conditions", http.MethodGet, nil, `"a"`, modified, 0},
+
+		{"if-match matches", http.MethodPut, map[string]string{"If-Match": `"a"`}, `"a"`, time.Time{}, 0},
+		{"if-match list", http.MethodPut, map[string]string{"If-Match": `"x", "a"`}, `"a"`, time.Time{}, 0},
+		{"if-match differs", http.MethodPut, map[string]string{"If-Match": `"b"`}, `"a"`, time.Time{}, http.StatusPreconditionFailed},
+		{"if-match weak etag", http.MethodPut, map[string]string{"If-Match": `W/"a"`}, `W/"a"`, time.Time{}, http.StatusPreconditionFailed},
+		{"if-match star", http.MethodPut, map[string]string{"If-Match": "*"}, `"a"`, time.Time{}, 0},
+		{"if-match without etag", http.MethodPut, map[string]string{"If-Match": `"a"`}, "", modified, http.StatusPreconditionFailed},
+		{"if-match star without etag", http.MethodPut, map[string]string{"If-Match": "*"}, "", modified, 0},
+
+		{"if-unmodified-since passes", http.MethodPut, map[string]string{"If-Unmodified-Since": after}, "", modified, 0},
+		{"if-unmodified-since fails", http.MethodPut, map[string]string{"If-Unmodified-Since": before}, "", modified, http.StatusPreconditionFailed},
+		{"if-match overrides if-unmodified-since", http.MethodPut, map[string]string{"If-Match": `"a"`, "If-Unmodified-Since": before}, `"a"`, modified, 0},
+
+		{"if-none-match matches get", http.MethodGet, map[string]string{"If-None-Match": `"a"`}, `"a"`, time.Time{}, http.StatusNotModified},
+		{"if-none-match weak comparison", http.MethodGet, map[string]string{"If-None-Match": `W/"a"`}, `"a"`, time.Time{}, http.StatusNotModified},
+		{"if-none-match differs", http.MethodGet, map[string]string{"If-None-Match": `"b"`}, `"a"`, time.Time{}, 0},
+		{"if-none-match star put", http.MethodPut, map[string]string{"If-None-Match": "*"}, `"a"`, time.Time{}, http.StatusPreconditionFailed},
+		{"if-none-match overrides if-modified-since", http.MethodGet, map[string]string{"If-None-Match": `"b"`, "If-Modified-Since": after}, `"a"`, modified, 0},
+
+		{"if-modified-since not modified", http.MethodGet, map[string]string{"If-Modified-Since": after}, "", modified, http.StatusNotModified},
+		{"if-modified-since modified", http.MethodGet, map[string]string{"If-Modified-Since": before}, "", modified, 0},
+		{"if-modified-since ignored for post", http.MethodPost, map[string]string{"If-Modified-Since": after}, "", modified, 0},
+		{"if-modified-since invalid date", http.MethodGet, map[string]string{"If-Modified-Since": "yesterday"}, "", modified, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+
+			c := &Context{}
+			c.reset(httptest.NewRecorder(), req)
+			if tt.etag != "" {
+				c.Writer.Header().Set("ETag", tt.etag)
+			}
+			if !tt.lastModified.IsZero() {
+				c.Writer.Header().Set("Last-Modified", tt.lastModified.Format(http.TimeFormat))
+			}
+
+			if got := c.checkPreconditions(); got != tt.want {
+				t.Errorf("checkPreconditions() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestETagMiddlewareIfMatch(t *testing.T) {
+	r := New()
+	r.Use(ETag())
+	r.GET("/", func(c *Context) {
+		if c.LastModified(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+			return
+		}
+		c.String(http.StatusOK, "%s", "body")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+
+	tests := []struct {
+		ifMatch string
+		want    int
+	}{
+		{etag, http.StatusOK},
+		{`"other"`, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ifMatch, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("If-Match", tt.ifMatch)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -14,7 +14,7 @@ func (g *RouterGroup) Group(prefix string, middleware ...HandlerFunc) *RouterGro
 		prefix:     g.prefix + prefix,
 		parent:     g,
 		router:     g.router,
-		middleware: append(g.combineMiddleware(), middleware...),
+		middleware: middleware,
 	}
 }
 
@@ -32,11 +32,16 @@ func (g *RouterGroup) combineMiddleware() []HandlerFunc {
 }
 
 // handle registers a route with group middleware
-func (g *RouterGroup) handle(method, path string, handler HandlerFunc) {
-	fullPath := g.prefix + path
+func (g *RouterGroup) handle(method, path string, handler HandlerFunc) *Route {
+	route := g.router.addRoute(method, g.prefix+path, g.wrap(handler))
+	route.group = g
+	return route
+}
 
+// wrap returns a handler that runs the group middleware before the handler
+func (g *RouterGroup) wrap(handler HandlerFunc) HandlerFunc {
 	// Combine group middleware with handler
-	finalHandler := func(c *Context) {
+	return func(c *Context) {
 		// Inject group middleware before the handler
 		groupMiddleware := g.combineMiddleware()
 
@@ -60,43 +65,41 @@ func (g *RouterGroup) handle(method, path string, handler HandlerFunc) {
 		c.handlers = originalHandlers
 		c.index = originalIndex
 	}
-
-	g.router.addRoute(method, fullPath, finalHandler)
 }
 
 // GET registers a GET route in the group
-func (g *RouterGroup) GET(path string, handler HandlerFunc) {
-	g.handle("GET", path, handler)
+func (g *RouterGroup) GET(path string, handler HandlerFunc) *Route {
+	return g.handle("GET", path, handler)
 }
 
 // POST registers a POST route in the group
-func (g *RouterGroup) POST(path string, handler HandlerFunc) {
-	g.handle("POST", path, handler)
+func (g *RouterGroup) POST(path string, handler HandlerFunc) *Route {
+	return g.handle("POST", path, handler)
 }
 
 // PUT registers a PUT route in the group
-func (g *RouterGroup) PUT(path string, handler HandlerFunc) {
-	g.handle("PUT", path, handler)
+func (g *RouterGroup) PUT(path string, handler HandlerFunc) *Route {
+	return g.handle("PUT", path, handler)
 }
 
 // DELETE registers a DELETE route in the group
-func (g *RouterGroup) DELETE(path string, handler HandlerFunc) {
-	g.handle("DELETE", path, handler)
+func (g *RouterGroup) DELETE(path string, handler HandlerFunc) *Route {
+	return g.handle("DELETE", path, handler)
 }
 
 // PATCH registers a PATCH route in the group
-func (g *RouterGroup) PATCH(path string, handler HandlerFunc) {
-	g.handle("PATCH", path, handler)
+func (g *RouterGroup) PATCH(path string, handler HandlerFunc) *Route {
+	return g.handle("PATCH", path, handler)
 }
 
 // HEAD registers a HEAD route in the group
-func (g *RouterGroup) HEAD(path string, handler HandlerFunc) {
-	g.handle("HEAD", path, handler)
+func (g *RouterGroup) HEAD(path string, handler HandlerFunc) *Route {
+	return g.handle("HEAD", path, handler)
 }
 
 // OPTIONS registers an OPTIONS route in the group
-func (g *RouterGroup) OPTIONS(path string, handler HandlerFunc) {
-	g.handle("OPTIONS", path, handler)
+func (g *RouterGroup) OPTIONS(path string, handler HandlerFunc) *Route {
+	return g.handle("OPTIONS", path, handler)
 }
 
 // Any registers a route for all HTTP methods in the group
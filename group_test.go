@@ -0,0 +1,56 @@
+package aqylly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNestedGroupMiddleware(t *testing.T) {
+	var calls []string
+	mark := func(name string) HandlerFunc {
+		return func(c *Context) {
+			calls = append(calls, name)
+			c.Next()
+		}
+	}
+
+	r := New()
+	api := r.Group("/api", mark("api"))
+	v1 := api.Group("/v1", mark("v1"))
+	v1.Use(mark("v1-use"))
+	admin := v1.Group("/admin", mark("admin"))
+
+	handler := func(c *Context) {
+		calls = append(calls, "handler")
+		c.String(http.StatusOK, "ok")
+	}
+	api.GET("/ping", handler)
+	v1.GET("/users", handler)
+	admin.GET("/stats", handler)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/ping", "api,handler"},
+		{"/api/v1/users", "api,v1,v1-use,handler"},
+		{"/api/v1/admin/stats", "api,v1,v1-use,admin,handler"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			calls = nil
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := strings.Join(calls, ","); got != tt.want {
+				t.Errorf("calls = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package aqylly
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errShuttingDown is reported by the readiness endpoint once Shutdown has begun
+var errShuttingDown = errors.New("server is shutting down")
+
+// Checker is a named health check
+type Checker struct {
+	// Name identifies the check in the report
+	Name string
+
+	// Check returns an error when the dependency is unhealthy
+	Check func(ctx context.Context) error
+
+	// Timeout bounds the check (default: 5s)
+	Timeout time.Duration
+
+	// Liveness also runs the check on the liveness endpoint. Leave it unset
+	// for dependencies whose failure a restart would not fix.
+	Liveness bool
+}
+
+// HealthReport is the JSON body of the health endpoints
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// HealthCheckResult is the outcome of one check
+type HealthCheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Health registers health endpoints under path:
+//
+//	GET path        all checks, failing once Shutdown has begun
+//	GET path/live   liveness: only the checks marked Liveness
+//	GET path/ready  readiness: same as path
+//
+// Checks run concurrently. A passing report is answered with 200 and a
+// failing one with 503.
+func (r *Router) Health(path string, checks ...Checker) {
+	for i := range checks {
+		if checks[i].Name == "" || checks[i].Check == nil {
+			panic("Health: checks need a Name and a Check function")
+		}
+		if checks[i].Timeout <= 0 {
+			checks[i].Timeout = 5 * time.Second
+		}
+	}
+
+	var liveness []Checker
+	for _, check := range checks {
+		if check.Liveness {
+			liveness = append(liveness, check)
+		}
+	}
+
+	readiness := func(c *Context) {
+		writeHealthReport(c, runChecks(c.Context(), checks, r.shuttingDown.Load()))
+	}
+	live := func(c *Context) {
+		writeHealthReport(c, runChecks(c.Context(), liveness, false))
+	}
+
+	base := path
+	if base == "/" {
+		base = ""
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		r.addRoute(method, path, readiness)
+		r.addRoute(method, base+"/live", live)
+		r.addRoute(method, base+"/ready", readiness)
+	}
+}
+
+// runChecks runs the checks concurrently and aggregates the results
+func runChecks(ctx context.Context, checks []Checker, shuttingDown bool) HealthReport {
+	report := HealthReport{Status: "ok"}
+	if len(checks) > 0 {
+		report.Checks = make(map[string]HealthCheckResult, len(checks))
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Checker) {
+			defer wg.Done()
+			result := runCheck(ctx, check)
+
+			mu.Lock()
+			report.Checks[check.Name] = result
+			if result.Status != "ok" {
+				report.Status = "fail"
+			}
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	if shuttingDown {
+		report.Status = "fail"
+		if report.Checks == nil {
+			report.Checks = make(map[string]HealthCheckResult, 1)
+		}
+		report.Checks["shutdown"] = HealthCheckResult{Status: "fail", Error: errShuttingDown.Error(), Duration: "0s"}
+	}
+
+	return report
+}
+
+// runCheck runs a check with its timeout, recovering from panics
+func runCheck(ctx context.Context, check Checker) (result HealthCheckResult) {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				done <- errors.New("check panicked")
+			}
+		}()
+		done <- check.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result.Duration = time.Since(start).String()
+	if err != nil {
+		result.Status = "fail"
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = "ok"
+	return result
+}
+
+// writeHealthReport answers with 200 for a passing report and 503 otherwise
+func writeHealthReport(c *Context, report HealthReport) {
+	c.SetHeader("Cache-Control", "no-store")
+
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
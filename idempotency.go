@@ -0,0 +1,332 @@
+package aqylly
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Idempotency store errors
+var (
+	// ErrIdempotencyKeyExists is returned by IdempotencyStore.Lock when the key is already taken
+	ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+
+	// ErrIdempotencyLockLost is returned by IdempotencyStore.Save when the
+	// lock expired and another request took the key
+	ErrIdempotencyLockLost = errors.New("idempotency lock lost")
+)
+
+// IdempotencyRecord is the state of an idempotency key
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request payload the key was first used with
+	Fingerprint string
+
+	// Token identifies the request holding the lock
+	Token string
+
+	// Completed is false while the first request is being processed
+	Completed bool
+
+	// Status, Header and Body hold the stored response once completed
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore stores idempotency keys. Implement it to share keys between instances.
+type IdempotencyStore interface {
+	// Lock creates an in-flight record for key. If the key exists it returns
+	// the existing record and ErrIdempotencyKeyExists.
+	Lock(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error)
+
+	// Save replaces the record of key with the completed response. It
+	// returns ErrIdempotencyLockLost if another request holds the key.
+	Save(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+
+	// Unlock removes the record of key so the request can be retried,
+	// unless another request than the one with token holds the key
+	Unlock(ctx context.Context, key, token string) error
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore. Expired keys
+// are dropped at most once a minute.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]memoryIdempotencyRecord
+	lastSweep time.Time
+}
+
+// memoryIdempotencyRecord is a record with its expiry
+type memoryIdempotencyRecord struct {
+	record    *IdempotencyRecord
+	expiresAt time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records:   make(map[string]memoryIdempotencyRecord),
+		lastSweep: time.Now(),
+	}
+}
+
+// Lock implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Lock(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.records[key]; ok && now.Before(existing.expiresAt) {
+		return existing.record, ErrIdempotencyKeyExists
+	}
+
+	// Drop expired keys once a minute so the sweep stays amortised
+	if now.Sub(s.lastSweep) >= time.Minute {
+		for k, r := range s.records {
+			if !now.Before(r.expiresAt) {
+				delete(s.records, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	s.records[key] = memoryIdempotencyRecord{record: record, expiresAt: now.Add(ttl)}
+	return record, nil
+}
+
+// Save implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Save(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[key]; ok && existing.record.Token != record.Token {
+		return ErrIdempotencyLockLost
+	}
+	s.records[key] = memoryIdempotencyRecord{record: record, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// Unlock implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Unlock(ctx context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[key]; ok && existing.record.Token == token {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// IdempotencyConfig holds the configuration for the Idempotency middleware
+type IdempotencyConfig struct {
+	// Store holds the keys and stored responses (default: in memory)
+	Store IdempotencyStore
+
+	// Header is the request header carrying the key (default: "Idempotency-Key")
+	Header string
+
+	// Methods are the methods the middleware applies to (default: POST, PATCH)
+	Methods []string
+
+	// Required rejects requests without a key with 400
+	Required bool
+
+	// TTL is how long completed responses are kept (default: 24h)
+	TTL time.Duration
+
+	// LockTTL is how long an in-flight key stays locked if the
+	// instance handling it never completes (default: 1m)
+	LockTTL time.Duration
+
+	// MaxBodySize is the largest request body that is read to fingerprint
+	// the request (default: 1 MB). Larger bodies are rejected with 413.
+	MaxBodySize int64
+
+	// MaxResponseSize is the largest response body that is stored (default: 1 MB).
+	// Larger responses release the key so the request can be retried.
+	MaxResponseSize int
+
+	// Scope returns a prefix that keeps keys of different clients apart
+	// (default: the authenticated user, so register Idempotency after the
+	// authentication middleware)
+	Scope func(c *Context) string
+
+	// AllowAnonymous accepts keys from requests with an empty scope, which
+	// then share one key space. Otherwise such requests are processed
+	// without idempotency and a warning is logged once.
+	AllowAnonymous bool
+}
+
+// Idempotency returns a middleware implementing the Idempotency-Key header.
+// The first request with a key is processed and its response stored; retries
+// with the same key and payload replay it. A retry while the first request is
+// in flight gets 409 and reusing a key with a different payload gets 422.
+// Responses with a 5xx status are not stored.
+func Idempotency(config IdempotencyConfig) HandlerFunc {
+	if config.Store == nil {
+		config.Store = NewMemoryIdempotencyStore()
+	}
+	if config.Header == "" {
+		config.Header = "Idempotency-Key"
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.LockTTL <= 0 {
+		config.LockTTL = time.Minute
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1 << 20
+	}
+	if config.MaxResponseSize <= 0 {
+		config.MaxResponseSize = 1 << 20
+	}
+	if config.Scope == nil {
+		config.Scope = func(c *Context) string {
+			return c.AuthUser()
+		}
+	}
+
+	var anonymous sync.Once
+	methods := make(map[string]bool, len(config.Methods))
+	for _, method := range config.Methods {
+		methods[method] = true
+	}
+
+	return func(c *Context) {
+		if !methods[c.Method()] {
+			c.Next()
+			return
+		}
+
+		idempotencyKey := c.Header(config.Header)
+		if idempotencyKey == "" {
+			if config.Required {
+				c.AbortWithJSON(http.StatusBadRequest, map[string]string{
+					"error": config.Header + " header is required",
+				})
+				return
+			}
+			c.Next()
+			return
+		}
+		if len(idempotencyKey) > 255 {
+			c.AbortWithJSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid " + config.Header + " header",
+			})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.AbortWithJSON(http.StatusRequestEntityTooLarge, map[string]string{
+					"error": "request body too large",
+				})
+				return
+			}
+			c.AbortWithJSON(http.StatusBadRequest, map[string]string{
+				"error": "failed to read request body",
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := config.Scope(c)
+		if scope == "" && !config.AllowAnonymous {
+			anonymous.Do(func() {
+				c.Logger().Warn("idempotency key ignored for a request without a scope; register Idempotency after authentication or set AllowAnonymous")
+			})
+			c.Next()
+			return
+		}
+
+		key := scope + "\x00" + idempotencyKey
+		fingerprint := requestFingerprint(c, body)
+		ctx := c.Context()
+
+		token := NewUUIDv4()
+		record, err := config.Store.Lock(ctx, key, &IdempotencyRecord{Fingerprint: fingerprint, Token: token}, config.LockTTL)
+		if errors.Is(err, ErrIdempotencyKeyExists) {
+			switch {
+			case record.Fingerprint != fingerprint:
+				c.AbortWithJSON(http.StatusUnprocessableEntity, map[string]string{
+					"error": config.Header + " was already used with a different request",
+				})
+			case !record.Completed:
+				c.AbortWithJSON(http.StatusConflict, map[string]string{
+					"error": "a request with this " + config.Header + " is being processed",
+				})
+			default:
+				replayIdempotent(c, record)
+			}
+			return
+		}
+		if err != nil {
+			c.AbortWithJSON(http.StatusServiceUnavailable, map[string]string{
+				"error": "Service Unavailable",
+			})
+			return
+		}
+
+		writer := &cacheWriter{ResponseWriter: c.Writer, limit: config.MaxResponseSize}
+		c.Writer = writer
+		saved := false
+		defer func() {
+			c.Writer = writer.ResponseWriter
+			if !saved {
+				config.Store.Unlock(context.WithoutCancel(ctx), key, token)
+			}
+		}()
+
+		c.Next()
+
+		if writer.header == nil || writer.overflow || writer.flushed || writer.status >= 500 {
+			return
+		}
+
+		err = config.Store.Save(context.WithoutCancel(ctx), key, &IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Token:       token,
+			Completed:   true,
+			Status:      writer.status,
+			Header:      writer.header,
+			Body:        writer.body.Bytes(),
+		}, config.TTL)
+		saved = err == nil
+	}
+}
+
+// requestFingerprint hashes the method, path and body of a request
+func requestFingerprint(c *Context, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method() + " " + c.Request.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replayIdempotent writes a stored response. Headers already set for this
+// request, such as the request ID, are kept.
+func replayIdempotent(c *Context, record *IdempotencyRecord) {
+	header := c.Writer.Header()
+	for key, values := range record.Header {
+		if _, ok := header[key]; !ok {
+			header[key] = append([]string(nil), values...)
+		}
+	}
+	header.Set("Idempotent-Replayed", "true")
+
+	c.Writer.WriteHeader(record.Status)
+	c.Writer.Write(record.Body)
+	c.Abort()
+}
@@ -0,0 +1,209 @@
+package aqylly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// idempotencyRouter returns a router whose POST /orders handler counts its calls
+func idempotencyRouter(config IdempotencyConfig, calls *int) *Router {
+	r := New()
+	r.Use(func(c *Context) {
+		if user := c.Header("X-User"); user != "" {
+			c.Set(AuthUserKey, user)
+		}
+		c.Next()
+	})
+	r.Use(Idempotency(config))
+	r.POST("/orders", func(c *Context) {
+		*calls++
+		c.String(http.StatusCreated, "%s", "order "+c.PostForm("item"))
+	})
+	return r
+}
+
+func TestIdempotency(t *testing.T) {
+	calls := 0
+	r := idempotencyRouter(IdempotencyConfig{MaxBodySize: 64}, &calls)
+
+	tests := []struct {
+		name     string
+		key      string
+		user     string
+		body     string
+		want     int
+		replayed bool
+		calls    int
+	}{
+		{"first request", "k1", "alice", "item=book", http.StatusCreated, false, 1},
+		{"retry", "k1", "alice", "item=book", http.StatusCreated, true, 1},
+		{"different payload", "k1", "alice", "item=pen", http.StatusUnprocessableEntity, false, 1},
+		{"other user", "k1", "bob", "item=book", http.StatusCreated, false, 2},
+		{"no key", "", "alice", "item=book", http.StatusCreated, false, 3},
+		{"body too large", "k2", "alice", "item=" + strings.Repeat("x", 64), http.StatusRequestEntityTooLarge, false, 3},
+		{"key too long", strings.Repeat("k", 256), "alice", "item=book", http.StatusBadRequest, false, 3},
+		{"no scope", "k3", "", "item=book", http.StatusCreated, false, 4},
+		{"no scope retry", "k3", "", "item=book", http.StatusCreated, false, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-User", tt.user)
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.replayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.replayed)
+			}
+			if calls != tt.calls {
+				t.Errorf("handler calls = %d, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyAllowAnonymous(t *testing.T) {
+	calls := 0
+	r := idempotencyRouter(IdempotencyConfig{AllowAnonymous: true}, &calls)
+
+	for i, want := range []string{"", "true"} {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("item=book"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Idempotency-Key", "k1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, http.StatusCreated)
+		}
+		if got := w.Header().Get("Idempotent-Replayed"); got != want {
+			t.Errorf("request %d: Idempotent-Replayed = %q, want %q", i, got, want)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler calls = %d, want 1", calls)
+	}
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+
+	if _, err := store.Lock(ctx, "old", &IdempotencyRecord{}, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// An expired key can be taken again
+	if _, err := store.Lock(ctx, "old", &IdempotencyRecord{}, time.Minute); err != nil {
+		t.Fatalf("Lock of expired key: %v", err)
+	}
+	if _, err := store.Lock(ctx, "old", &IdempotencyRecord{}, time.Minute); err != ErrIdempotencyKeyExists {
+		t.Fatalf("Lock of live key: %v, want %v", err, ErrIdempotencyKeyExists)
+	}
+
+	if _, err := store.Lock(ctx, "expired", &IdempotencyRecord{}, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// Expired keys are swept once the interval has passed
+	store.lastSweep = time.Now().Add(-2 * time.Minute)
+	if _, err := store.Lock(ctx, "new", &IdempotencyRecord{}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.records["expired"]; ok {
+		t.Error("expired key was not swept")
+	}
+	if len(store.records) != 2 {
+		t.Errorf("store holds %d keys, want 2", len(store.records))
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	entered := make(chan struct{}, 2)
+	release := make(chan int, 2)
+
+	r := New()
+	r.Use(Idempotency(IdempotencyConfig{AllowAnonymous: true, LockTTL: 50 * time.Millisecond}))
+	r.POST("/payments", func(c *Context) {
+		entered <- struct{}{}
+		c.String(<-release, "%s", "paid")
+	})
+
+	results := make(chan int, 2)
+	pay := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader("amount=10"))
+		req.Header.Set("Idempotency-Key", "k1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A retry while the first request runs gets 409
+	go func() { results <- pay() }()
+	<-entered
+	if code := pay(); code != http.StatusConflict {
+		t.Fatalf("retry while in flight: status = %d, want %d", code, http.StatusConflict)
+	}
+
+	// The first request outlives its lock and a retry takes the key over
+	time.Sleep(100 * time.Millisecond)
+	go func() { results <- pay() }()
+	<-entered
+
+	// The first request fails; it must not release the retry's lock
+	release <- http.StatusInternalServerError
+	if code := <-results; code != http.StatusInternalServerError {
+		t.Fatalf("first request: status = %d, want %d", code, http.StatusInternalServerError)
+	}
+	if code := pay(); code != http.StatusConflict {
+		t.Fatalf("retry after the stale request ended: status = %d, want %d", code, http.StatusConflict)
+	}
+
+	release <- http.StatusCreated
+	if code := <-results; code != http.StatusCreated {
+		t.Fatalf("second request: status = %d, want %d", code, http.StatusCreated)
+	}
+}
+
+func TestMemoryIdempotencyStoreOwner(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+
+	if _, err := store.Lock(ctx, "k", &IdempotencyRecord{Token: "a"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Unlock(ctx, "k", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, "k", &IdempotencyRecord{Token: "b", Completed: true}, time.Minute); err != ErrIdempotencyLockLost {
+		t.Fatalf("Save by another owner: %v, want %v", err, ErrIdempotencyLockLost)
+	}
+	if record := store.records["k"].record; record.Token != "a" || record.Completed {
+		t.Fatalf("record = %+v, want the lock of a", record)
+	}
+
+	if err := store.Save(ctx, "k", &IdempotencyRecord{Token: "a", Completed: true}, time.Minute); err != nil {
+		t.Fatalf("Save by the owner: %v", err)
+	}
+	if err := store.Unlock(ctx, "k", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.records["k"]; ok {
+		t.Error("Unlock by the owner kept the record")
+	}
+}
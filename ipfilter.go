@@ -0,0 +1,188 @@
+package aqylly
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrIPDenied is passed to the IPFilter error handler when a client is rejected
+var ErrIPDenied = errors.New("client IP is not allowed")
+
+// IPList is a set of IPv4 and IPv6 addresses and CIDR ranges that can be
+// replaced while it is in use
+type IPList struct {
+	mu       sync.RWMutex
+	prefixes []netip.Prefix
+	path     string
+	modTime  time.Time
+}
+
+// NewIPList creates a list from IP addresses and CIDR ranges
+func NewIPList(entries ...string) (*IPList, error) {
+	l := &IPList{}
+	if err := l.Set(entries...); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// LoadIPList creates a list from a file with one address or CIDR range
+// per line. Blank lines and text after '#' are ignored.
+func LoadIPList(path string) (*IPList, error) {
+	l := &IPList{path: path}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Set replaces the entries of the list
+func (l *IPList) Set(entries ...string) error {
+	prefixes, err := parsePrefixes(entries)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.prefixes = prefixes
+	l.mu.Unlock()
+	return nil
+}
+
+// Contains reports whether the address is in the list
+func (l *IPList) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload reads the file the list was loaded from again. On error the
+// current entries are kept.
+func (l *IPList) Reload() error {
+	if l.path == "" {
+		return errors.New("IPList: not loaded from a file")
+	}
+
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return err
+	}
+
+	var entries []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+
+	if err := l.Set(entries...); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.modTime = info.ModTime()
+	l.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the file whenever its modification time changes, checking
+// every interval until ctx is done. Reload errors are logged and the
+// current entries are kept. It returns immediately for a list that was
+// not loaded from a file.
+func (l *IPList) Watch(ctx context.Context, interval time.Duration) {
+	if l.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(l.path)
+		if err != nil {
+			slog.Default().Warn("ip list reload failed", slog.String("path", l.path), slog.Any("error", err))
+			continue
+		}
+
+		l.mu.RLock()
+		changed := !info.ModTime().Equal(l.modTime)
+		l.mu.RUnlock()
+
+		if changed {
+			if err := l.Reload(); err != nil {
+				slog.Default().Warn("ip list reload failed", slog.String("path", l.path), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// IPFilterConfig holds the configuration for the IPFilter middleware
+type IPFilterConfig struct {
+	// Allow lists the clients that may access the routes.
+	// When nil, every client that is not denied is allowed.
+	Allow *IPList
+
+	// Deny lists the clients that are rejected. It takes precedence over Allow.
+	Deny *IPList
+
+	// ErrorHandler is called when a client is rejected (default: 403 JSON)
+	ErrorHandler func(c *Context, err error)
+}
+
+// IPFilter returns a middleware that allows or denies requests by client IP.
+// The client IP is resolved with c.ClientIP(), so forwarding headers are only
+// honored from Router.TrustedProxies.
+func IPFilter(config IPFilterConfig) HandlerFunc {
+	if config.Allow == nil && config.Deny == nil {
+		panic("IPFilter: Allow or Deny is required")
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(c *Context, err error) {
+			c.AbortWithJSON(http.StatusForbidden, map[string]string{
+				"error": "Forbidden",
+			})
+		}
+	}
+
+	return func(c *Context) {
+		addr, ok := parseIP(c.ClientIP())
+		if !ok ||
+			(config.Deny != nil && config.Deny.Contains(addr)) ||
+			(config.Allow != nil && !config.Allow.Contains(addr)) {
+			config.ErrorHandler(c, ErrIPDenied)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
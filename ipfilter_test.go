@@ -0,0 +1,143 @@
+package aqylly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIPListContains(t *testing.T) {
+	l, err := NewIPList("10.0.0.0/8", "192.0.2.1", "2001:db8::/32", "::ffff:198.51.100.0/120")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"192.0.2.1", true},
+		{"192.0.2.2", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"::ffff:10.1.2.3", true},
+		{"::ffff:192.0.2.1", true},
+		{"198.51.100.7", true},
+		{"::ffff:198.51.100.7", true},
+		{"198.51.101.7", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := l.Contains(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("Contains(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	allow, err := NewIPList("10.0.0.0/8", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deny, err := NewIPList("10.0.0.66", "2001:db8::bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config IPFilterConfig
+		remote string
+		want   int
+	}{
+		{"allowed", IPFilterConfig{Allow: allow, Deny: deny}, "10.0.0.1:1234", http.StatusOK},
+		{"not in allow list", IPFilterConfig{Allow: allow, Deny: deny}, "192.0.2.1:1234", http.StatusForbidden},
+		{"deny wins over allow", IPFilterConfig{Allow: allow, Deny: deny}, "10.0.0.66:1234", http.StatusForbidden},
+		{"deny wins over allow ipv6", IPFilterConfig{Allow: allow, Deny: deny}, "[2001:db8::bad]:1234", http.StatusForbidden},
+		{"ipv4-mapped client", IPFilterConfig{Allow: allow, Deny: deny}, "[::ffff:10.0.0.1]:1234", http.StatusOK},
+		{"ipv4-mapped denied client", IPFilterConfig{Allow: allow, Deny: deny}, "[::ffff:10.0.0.66]:1234", http.StatusForbidden},
+		{"deny only", IPFilterConfig{Deny: deny}, "192.0.2.1:1234", http.StatusOK},
+		{"deny only denied", IPFilterConfig{Deny: deny}, "10.0.0.66:1234", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			r.Use(IPFilter(tt.config))
+			r.GET("/", func(c *Context) { c.String(http.StatusOK, "ok") })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPListReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allow.txt")
+	if err := os.WriteFile(path, []byte("# office\n10.0.0.0/8 # vpn\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := LoadIPList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Contains(netip.MustParseAddr("10.1.1.1")) {
+		t.Fatal("expected 10.1.1.1 to be listed")
+	}
+
+	// An invalid file keeps the current entries
+	if err := os.WriteFile(path, []byte("not an ip\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reload(); err == nil {
+		t.Fatal("expected a reload error")
+	}
+	if !l.Contains(netip.MustParseAddr("10.1.1.1")) {
+		t.Error("expected the entries to be kept after a failed reload")
+	}
+
+	if err := os.WriteFile(path, []byte("192.0.2.1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if l.Contains(netip.MustParseAddr("10.1.1.1")) || !l.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("expected the new entries after a reload")
+	}
+}
+
+func TestIPListWatchWithoutFile(t *testing.T) {
+	l, err := NewIPList("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.Watch(context.Background(), time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not return for a list without a file")
+	}
+}
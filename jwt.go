@@ -0,0 +1,477 @@
+package aqylly
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTClaimsKey is the context key under which JWTAuth stores the token claims
+const JWTClaimsKey = "aqylly.jwt.claims"
+
+// JWT validation errors
+var (
+	ErrTokenMissing     = errors.New("jwt: token missing")
+	ErrTokenMalformed   = errors.New("jwt: token malformed")
+	ErrTokenAlgorithm   = errors.New("jwt: algorithm not allowed")
+	ErrTokenKeyNotFound = errors.New("jwt: key not found")
+	ErrTokenSignature   = errors.New("jwt: signature invalid")
+	ErrTokenExpired     = errors.New("jwt: token expired")
+	ErrTokenMissingExp  = errors.New("jwt: exp claim missing")
+	ErrTokenNotValidYet = errors.New("jwt: token not valid yet")
+	ErrTokenIssuer      = errors.New("jwt: issuer invalid")
+	ErrTokenAudience    = errors.New("jwt: audience invalid")
+	ErrTokenKeyType     = errors.New("jwt: unsupported key type")
+)
+
+// JWTClaims holds the claims of a verified token
+type JWTClaims map[string]interface{}
+
+// Subject returns the "sub" claim
+func (c JWTClaims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// Issuer returns the "iss" claim
+func (c JWTClaims) Issuer() string {
+	s, _ := c["iss"].(string)
+	return s
+}
+
+// Audience returns the "aud" claim, which may be a string or an array
+func (c JWTClaims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		result := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// time returns a NumericDate claim as time. ok is false when the claim is
+// absent; a claim that is not a number is malformed.
+func (c JWTClaims) time(name string) (t time.Time, ok bool, err error) {
+	v, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	seconds, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false, ErrTokenMalformed
+	}
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+// JWTConfig holds the configuration for the JWTAuth middleware
+type JWTConfig struct {
+	// Key verifies tokens without a "kid" header, or all tokens when KeySet is nil.
+	// Use []byte for HS256, *rsa.PublicKey for RS256,
+	// *ecdsa.PublicKey for ES256 and ed25519.PublicKey for EdDSA.
+	Key interface{}
+
+	// KeySet resolves keys by the "kid" header, allowing key rotation
+	KeySet *KeySet
+
+	// Algorithms lists the accepted "alg" values (default: HS256, RS256, ES256, EdDSA)
+	Algorithms []string
+
+	// Issuer is the required "iss" claim (optional)
+	Issuer string
+
+	// Audience lists accepted "aud" values; the token must contain one of them (optional)
+	Audience []string
+
+	// ClockSkew is the leeway applied to "exp" and "nbf"
+	ClockSkew time.Duration
+
+	// RequireExp rejects tokens without an "exp" claim
+	RequireExp bool
+
+	// ErrorHandler is called when authentication fails (default: 401 JSON)
+	ErrorHandler func(c *Context, err error)
+}
+
+// JWTAuth returns a middleware that authenticates Bearer tokens.
+// The verified claims are available through c.JWTClaims().
+func JWTAuth(config JWTConfig) HandlerFunc {
+	if config.Key == nil && config.KeySet == nil {
+		panic("JWTAuth: Key or KeySet is required")
+	}
+
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(c *Context, err error) {
+			c.SetHeader("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.AbortWithJSON(http.StatusUnauthorized, map[string]string{
+				"error": "Unauthorized",
+			})
+		}
+	}
+
+	return func(c *Context) {
+		auth := c.Header("Authorization")
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+			config.ErrorHandler(c, ErrTokenMissing)
+			c.Abort()
+			return
+		}
+
+		claims, err := config.verify(strings.TrimSpace(auth[7:]), time.Now())
+		if err != nil {
+			config.ErrorHandler(c, err)
+			c.Abort()
+			return
+		}
+
+		c.Set(JWTClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// JWTClaims returns the claims stored by JWTAuth
+func (c *Context) JWTClaims() JWTClaims {
+	if v, ok := c.Get(JWTClaimsKey); ok {
+		if claims, ok := v.(JWTClaims); ok {
+			return claims
+		}
+	}
+	return nil
+}
+
+// verify parses the token, checks its signature and validates the claims
+func (config *JWTConfig) verify(token string, now time.Time) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	algorithms := config.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"HS256", "RS256", "ES256", "EdDSA"}
+	}
+
+	allowed := false
+	for _, alg := range algorithms {
+		if alg == header.Alg {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, ErrTokenAlgorithm
+	}
+
+	key := config.Key
+	if header.Kid != "" && config.KeySet != nil {
+		k, ok := config.KeySet.Key(header.Kid)
+		if !ok {
+			return nil, ErrTokenKeyNotFound
+		}
+		key = k
+	}
+	if key == nil {
+		return nil, ErrTokenKeyNotFound
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims JWTClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	exp, hasExp, err := claims.time("exp")
+	if err != nil {
+		return nil, err
+	}
+	nbf, hasNbf, err := claims.time("nbf")
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := claims.time("iat"); err != nil {
+		return nil, err
+	}
+
+	if !hasExp && config.RequireExp {
+		return nil, ErrTokenMissingExp
+	}
+	if hasExp && !now.Before(exp.Add(config.ClockSkew)) {
+		return nil, ErrTokenExpired
+	}
+	if hasNbf && now.Before(nbf.Add(-config.ClockSkew)) {
+		return nil, ErrTokenNotValidYet
+	}
+	if config.Issuer != "" && claims.Issuer() != config.Issuer {
+		return nil, ErrTokenIssuer
+	}
+	if len(config.Audience) > 0 && !matchAudience(claims.Audience(), config.Audience) {
+		return nil, ErrTokenAudience
+	}
+
+	return claims, nil
+}
+
+// verifySignature checks the signature of the signing input with the key.
+// The key type must match the algorithm to prevent algorithm confusion.
+func verifySignature(alg string, key interface{}, input string, signature []byte) error {
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrTokenAlgorithm
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(input))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrTokenSignature
+		}
+		return nil
+
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrTokenAlgorithm
+		}
+		digest := sha256.Sum256([]byte(input))
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+			return ErrTokenSignature
+		}
+		return nil
+
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrTokenAlgorithm
+		}
+		if len(signature) != 64 {
+			return ErrTokenSignature
+		}
+		digest := sha256.Sum256([]byte(input))
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrTokenSignature
+		}
+		return nil
+
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return ErrTokenAlgorithm
+		}
+		if !ed25519.Verify(pub, []byte(input), signature) {
+			return ErrTokenSignature
+		}
+		return nil
+
+	default:
+		return ErrTokenAlgorithm
+	}
+}
+
+// matchAudience reports whether any token audience is accepted
+func matchAudience(tokenAud, accepted []string) bool {
+	for _, a := range tokenAud {
+		for _, b := range accepted {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url JSON segment
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// KeySet holds verification keys indexed by key ID.
+// It is safe for concurrent use and can be reloaded to rotate keys.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys map[string]interface{}
+}
+
+// NewKeySet creates an empty key set
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]interface{})}
+}
+
+// LoadKeySet creates a key set from a local JWKS file
+func LoadKeySet(path string) (*KeySet, error) {
+	ks := NewKeySet()
+	if err := ks.LoadFile(path); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Add adds or replaces a key
+func (ks *KeySet) Add(kid string, key interface{}) {
+	ks.mu.Lock()
+	ks.keys[kid] = key
+	ks.mu.Unlock()
+}
+
+// Remove removes a key
+func (ks *KeySet) Remove(kid string) {
+	ks.mu.Lock()
+	delete(ks.keys, kid)
+	ks.mu.Unlock()
+}
+
+// Key returns the key with the given ID
+func (ks *KeySet) Key(kid string) (interface{}, bool) {
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	ks.mu.RUnlock()
+	return key, ok
+}
+
+// LoadFile replaces all keys with the keys from a JWKS file
+func (ks *KeySet) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return ks.LoadJWKS(data)
+}
+
+// LoadJWKS replaces all keys with the keys from a JWKS document
+func (ks *KeySet) LoadJWKS(data []byte) error {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return fmt.Errorf("jwks: key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+	return nil
+}
+
+// jsonWebKey is a JSON Web Key (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts the JWK to a verification key
+func (jwk *jsonWebKey) publicKey() (interface{}, error) {
+	b64 := base64.RawURLEncoding
+
+	switch jwk.Kty {
+	case "oct":
+		return b64.DecodeString(jwk.K)
+
+	case "RSA":
+		n, err := b64.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, ErrTokenKeyType
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, ErrTokenKeyType
+		}
+		x, err := b64.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, ErrTokenKeyType
+		}
+		x, err := b64.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrTokenKeyType
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, ErrTokenKeyType
+	}
+}
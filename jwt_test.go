@@ -0,0 +1,253 @@
+package aqylly
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testKeys holds a key pair for every supported algorithm
+type testKeys struct {
+	hmac    []byte
+	rsa     *rsa.PrivateKey
+	ecdsa   *ecdsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKeys{hmac: []byte("secret"), rsa: rsaKey, ecdsa: ecKey, ed25519: edKey}
+}
+
+// public returns the verification key for the algorithm
+func (k *testKeys) public(alg string) interface{} {
+	switch alg {
+	case "HS256":
+		return k.hmac
+	case "RS256":
+		return &k.rsa.PublicKey
+	case "ES256":
+		return &k.ecdsa.PublicKey
+	case "EdDSA":
+		return k.ed25519.Public()
+	}
+	return nil
+}
+
+// sign creates a token with the given header and claims
+func (k *testKeys) sign(t *testing.T, header map[string]interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	input := segment(header) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch header["alg"] {
+	case "HS256":
+		mac := hmac.New(sha256.New, k.hmac)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case "RS256":
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, k.ecdsa, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case "EdDSA":
+		signature = ed25519.Sign(k.ed25519, []byte(input))
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Unix(1700000000, 0)
+	unix := func(d time.Duration) float64 {
+		return float64(now.Add(d).Unix())
+	}
+
+	for _, alg := range []string{"HS256", "RS256", "ES256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			header := map[string]interface{}{"alg": alg, "typ": "JWT"}
+
+			tests := []struct {
+				name   string
+				config JWTConfig
+				claims map[string]interface{}
+				want   error
+			}{
+				{"valid", JWTConfig{}, map[string]interface{}{"sub": "alice", "exp": unix(time.Hour)}, nil},
+				{"no exp", JWTConfig{}, map[string]interface{}{"sub": "alice"}, nil},
+				{"expired", JWTConfig{}, map[string]interface{}{"exp": unix(-time.Minute)}, ErrTokenExpired},
+				{"expired within skew", JWTConfig{ClockSkew: 2 * time.Minute}, map[string]interface{}{"exp": unix(-time.Minute)}, nil},
+				{"not valid yet", JWTConfig{}, map[string]interface{}{"nbf": unix(time.Minute)}, ErrTokenNotValidYet},
+				{"nbf within skew", JWTConfig{ClockSkew: 2 * time.Minute}, map[string]interface{}{"nbf": unix(time.Minute)}, nil},
+				{"string exp", JWTConfig{}, map[string]interface{}{"exp": "0"}, ErrTokenMalformed},
+				{"string nbf", JWTConfig{}, map[string]interface{}{"nbf": "9999999999"}, ErrTokenMalformed},
+				{"null exp", JWTConfig{}, map[string]interface{}{"exp": nil}, ErrTokenMalformed},
+				{"string iat", JWTConfig{}, map[string]interface{}{"iat": "now"}, ErrTokenMalformed},
+				{"require exp", JWTConfig{RequireExp: true}, map[string]interface{}{"sub": "alice"}, ErrTokenMissingExp},
+				{"require exp present", JWTConfig{RequireExp: true}, map[string]interface{}{"exp": unix(time.Hour)}, nil},
+				{"issuer", JWTConfig{Issuer: "https://auth"}, map[string]interface{}{"iss": "https://auth"}, nil},
+				{"wrong issuer", JWTConfig{Issuer: "https://auth"}, map[string]interface{}{"iss": "https://evil"}, ErrTokenIssuer},
+				{"audience array", JWTConfig{Audience: []string{"api"}}, map[string]interface{}{"aud": []string{"web", "api"}}, nil},
+				{"wrong audience", JWTConfig{Audience: []string{"api"}}, map[string]interface{}{"aud": "web"}, ErrTokenAudience},
+				{"algorithm not allowed", JWTConfig{Algorithms: []string{"none"}}, map[string]interface{}{}, ErrTokenAlgorithm},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					config := tt.config
+					config.Key = keys.public(alg)
+
+					claims, err := config.verify(keys.sign(t, header, tt.claims), now)
+					if !errors.Is(err, tt.want) {
+						t.Fatalf("verify() error = %v, want %v", err, tt.want)
+					}
+					if err == nil && claims["sub"] != tt.claims["sub"] {
+						t.Errorf("sub = %v, want %v", claims["sub"], tt.claims["sub"])
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestJWTVerifyKeys(t *testing.T) {
+	keys := newTestKeys(t)
+	other := newTestKeys(t)
+	now := time.Unix(1700000000, 0)
+	claims := map[string]interface{}{"sub": "alice"}
+
+	set := NewKeySet()
+	set.Add("rsa-1", &keys.rsa.PublicKey)
+
+	// An HS256 token signed with the RSA public key, the classic algorithm confusion attack
+	confused := &testKeys{hmac: keys.rsa.PublicKey.N.Bytes()}
+
+	tests := []struct {
+		name   string
+		config JWTConfig
+		token  string
+		want   error
+	}{
+		{"rsa key for hs256", JWTConfig{Key: &keys.rsa.PublicKey},
+			confused.sign(t, map[string]interface{}{"alg": "HS256"}, claims), ErrTokenAlgorithm},
+		{"hmac key for rs256", JWTConfig{Key: keys.hmac},
+			keys.sign(t, map[string]interface{}{"alg": "RS256"}, claims), ErrTokenAlgorithm},
+		{"ecdsa key for eddsa", JWTConfig{Key: &keys.ecdsa.PublicKey},
+			keys.sign(t, map[string]interface{}{"alg": "EdDSA"}, claims), ErrTokenAlgorithm},
+		{"ed25519 key for es256", JWTConfig{Key: keys.ed25519.Public()},
+			keys.sign(t, map[string]interface{}{"alg": "ES256"}, claims), ErrTokenAlgorithm},
+		{"wrong rsa key", JWTConfig{Key: &other.rsa.PublicKey},
+			keys.sign(t, map[string]interface{}{"alg": "RS256"}, claims), ErrTokenSignature},
+		{"wrong ecdsa key", JWTConfig{Key: &other.ecdsa.PublicKey},
+			keys.sign(t, map[string]interface{}{"alg": "ES256"}, claims), ErrTokenSignature},
+		{"wrong hmac secret", JWTConfig{Key: []byte("other")},
+			keys.sign(t, map[string]interface{}{"alg": "HS256"}, claims), ErrTokenSignature},
+		{"none algorithm", JWTConfig{Key: keys.hmac, Algorithms: []string{"HS256", "none"}},
+			keys.sign(t, map[string]interface{}{"alg": "none"}, claims), ErrTokenAlgorithm},
+		{"kid from key set", JWTConfig{KeySet: set},
+			keys.sign(t, map[string]interface{}{"alg": "RS256", "kid": "rsa-1"}, claims), nil},
+		{"unknown kid", JWTConfig{KeySet: set},
+			keys.sign(t, map[string]interface{}{"alg": "RS256", "kid": "rsa-2"}, claims), ErrTokenKeyNotFound},
+		{"no kid without key", JWTConfig{KeySet: set},
+			keys.sign(t, map[string]interface{}{"alg": "RS256"}, claims), ErrTokenKeyNotFound},
+		{"two segments", JWTConfig{Key: keys.hmac}, "a.b", ErrTokenMalformed},
+		{"bad header", JWTConfig{Key: keys.hmac}, "!!.e30.", ErrTokenMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.config.verify(tt.token, now); !errors.Is(err, tt.want) {
+				t.Errorf("verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	keys := newTestKeys(t)
+	token := keys.sign(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice"})
+
+	r := New()
+	r.Use(JWTAuth(JWTConfig{Key: keys.hmac}))
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.JWTClaims().Subject())
+	})
+
+	tests := []struct {
+		name  string
+		auth  string
+		want  int
+		body  string
+		realm bool
+	}{
+		{"valid", "Bearer " + token, http.StatusOK, "alice", false},
+		{"lowercase scheme", "bearer " + token, http.StatusOK, "alice", false},
+		{"missing", "", http.StatusUnauthorized, "", true},
+		{"basic scheme", "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized, "", true},
+		{"tampered", "Bearer " + token + "x", http.StatusUnauthorized, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.body)
+			}
+			if got := w.Header().Get("WWW-Authenticate") != ""; got != tt.realm {
+				t.Errorf("WWW-Authenticate set = %v, want %v", got, tt.realm)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package aqylly
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+)
+
+// LogFormat selects the output format of the Logger middleware
+type LogFormat int
+
+const (
+	// LogFormatStructured emits records through a *slog.Logger
+	LogFormatStructured LogFormat = iota
+
+	// LogFormatCommon writes lines in the Common Log Format
+	LogFormatCommon
+
+	// LogFormatCombined writes lines in the Combined Log Format
+	LogFormatCombined
+)
+
+// clfTimeFormat is the timestamp layout of the Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// LoggerConfig holds the configuration for the Logger middleware
+type LoggerConfig struct {
+	// Logger receives structured records (default: slog.Default())
+	Logger *slog.Logger
+
+	// Format selects structured, Common or Combined Log Format output
+	Format LogFormat
+
+	// Output receives Common and Combined Log Format lines (default: os.Stdout)
+	Output io.Writer
+
+	// SkipPaths lists request paths that are not logged
+	SkipPaths []string
+
+	// SampleRate is the fraction of successful (< 400) requests that are logged.
+	// Errors are always logged. Zero logs every request.
+	SampleRate float64
+
+	// Level returns the log level for a status code.
+	// By default 5xx is Error, 4xx is Warn and everything else is Info.
+	Level func(status int) slog.Level
+}
+
+// Logger returns a middleware that logs HTTP requests
+func Logger() HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{})
+}
+
+// LoggerWithConfig returns a middleware that logs HTTP requests after they complete
+func LoggerWithConfig(config LoggerConfig) HandlerFunc {
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+	if config.Level == nil {
+		config.Level = defaultLogLevel
+	}
+
+	skip := make(map[string]bool, len(config.SkipPaths))
+	for _, path := range config.SkipPaths {
+		skip[path] = true
+	}
+
+	return func(c *Context) {
+		path := c.Path()
+		if skip[path] {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+
+		// Process request
+		c.Next()
+
+		status := c.writer.status
+		if config.SampleRate > 0 && status < 400 && rand.Float64() >= config.SampleRate {
+			return
+		}
+
+		switch config.Format {
+		case LogFormatCommon, LogFormatCombined:
+			writeCLF(config.Output, c, start, config.Format == LogFormatCombined)
+
+		default:
+			attrs := []slog.Attr{
+				slog.String("method", c.Method()),
+				slog.String("route", c.Route()),
+				slog.String("path", path),
+				slog.Int("status", status),
+				slog.Int("bytes", c.writer.size),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("client_ip", c.ClientIP()),
+				slog.String("user_agent", c.Request.UserAgent()),
+			}
+			if requestID := c.RequestID(); requestID != "" {
+				attrs = append(attrs, slog.String("request_id", requestID))
+			}
+			attrs = append(attrs, c.logAttrs...)
+
+			config.Logger.LogAttrs(c.Context(), config.Level(status), "http request", attrs...)
+		}
+	}
+}
+
+// defaultLogLevel maps status codes to log levels
+func defaultLogLevel(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// writeCLF writes a Common or Combined Log Format line
+func writeCLF(w io.Writer, c *Context, start time.Time, combined bool) {
+	user := c.AuthUser()
+	if user == "" {
+		user = "-"
+	}
+
+	size := "-"
+	if c.writer.size > 0 {
+		size = strconv.Itoa(c.writer.size)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] %s %d %s",
+		c.ClientIP(),
+		user,
+		start.Format(clfTimeFormat),
+		strconv.Quote(c.Method()+" "+c.Request.RequestURI+" "+c.Request.Proto),
+		c.writer.status,
+		size,
+	)
+
+	if combined {
+		line += " " + quoteOrDash(c.Request.Referer()) + " " + quoteOrDash(c.Request.UserAgent())
+	}
+
+	_, _ = io.WriteString(w, line+"\n")
+}
+
+// quoteOrDash quotes a header value, or returns "-" when it is empty
+func quoteOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strconv.Quote(value)
+}
+
+// Logger returns a logger for the current request. It carries the request ID,
+// the route pattern, the trace IDs and the attributes added with SetLogAttrs.
+func (c *Context) Logger() *slog.Logger {
+	logger := slog.Default()
+	if c.router != nil && c.router.Logger != nil {
+		logger = c.router.Logger
+	}
+
+	attrs := make([]interface{}, 0, 4+len(c.logAttrs))
+	if requestID := c.RequestID(); requestID != "" {
+		attrs = append(attrs, slog.String("request_id", requestID))
+	}
+	if c.Route() != "" {
+		attrs = append(attrs, slog.String("route", c.Route()))
+	}
+	if span := c.Span(); span != nil {
+		sc := span.SpanContext()
+		attrs = append(attrs, slog.String("trace_id", sc.TraceIDString()), slog.String("span_id", sc.SpanIDString()))
+	} else if traceID, spanID, ok := parseTraceparent(c.Header("traceparent")); ok {
+		attrs = append(attrs, slog.String("trace_id", traceID), slog.String("span_id", spanID))
+	}
+	for _, attr := range c.logAttrs {
+		attrs = append(attrs, attr)
+	}
+
+	return logger.With(attrs...)
+}
+
+// SetLogAttrs adds attributes to the request logger and the access log
+func (c *Context) SetLogAttrs(attrs ...slog.Attr) {
+	c.logAttrs = append(c.logAttrs, attrs...)
+}
+
+// parseTraceparent extracts the trace and parent IDs of a W3C traceparent header
+func parseTraceparent(value string) (traceID, spanID string, ok bool) {
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return "", "", false
+	}
+	if !isLowerHex(value[:2]) || value[:2] == "ff" {
+		return "", "", false
+	}
+
+	traceID = value[3:35]
+	spanID = value[36:52]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(value[53:55]) ||
+		traceID == "00000000000000000000000000000000" || spanID == "0000000000000000" {
+		return "", "", false
+	}
+	if value[:2] == "00" && len(value) != 55 {
+		return "", "", false
+	}
+
+	return traceID, spanID, true
+}
+
+// isLowerHex reports whether s only contains lowercase hex digits
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package aqylly
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLoggerCLF(t *testing.T) {
+	clfTime := `\[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\]`
+
+	tests := []struct {
+		name    string
+		format  LogFormat
+		target  string
+		user    string
+		referer string
+		agent   string
+		want    string
+	}{
+		{
+			name:   "common",
+			format: LogFormatCommon,
+			target: "/items?q=1",
+			want:   `^192\.0\.2\.1 - - ` + clfTime + ` "GET /items\?q=1 HTTP/1\.1" 200 2\n$`,
+		},
+		{
+			name:   "common with user and empty body",
+			format: LogFormatCommon,
+			target: "/empty",
+			user:   "alice",
+			want:   `^192\.0\.2\.1 - alice ` + clfTime + ` "GET /empty HTTP/1\.1" 204 -\n$`,
+		},
+		{
+			name:    "combined",
+			format:  LogFormatCombined,
+			target:  "/items",
+			referer: "https://example.com/",
+			agent:   `curl/8.0 "quoted"`,
+			want:    `^192\.0\.2\.1 - - ` + clfTime + ` "GET /items HTTP/1\.1" 200 2 "https://example\.com/" "curl/8\.0 \\"quoted\\""\n$`,
+		},
+		{
+			name:   "combined without headers",
+			format: LogFormatCombined,
+			target: "/items",
+			want:   `^192\.0\.2\.1 - - ` + clfTime + ` "GET /items HTTP/1\.1" 200 2 - -\n$`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			r := New()
+			r.Use(LoggerWithConfig(LoggerConfig{Format: tt.format, Output: &out}))
+			r.Use(func(c *Context) {
+				if tt.user != "" {
+					c.Set(AuthUserKey, tt.user)
+				}
+				c.Next()
+			})
+			r.GET("/items", func(c *Context) { c.String(http.StatusOK, "ok") })
+			r.GET("/empty", func(c *Context) { c.Status(http.StatusNoContent) })
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+			if tt.agent != "" {
+				req.Header.Set("User-Agent", tt.agent)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !regexp.MustCompile(tt.want).MatchString(out.String()) {
+				t.Errorf("line = %q, want match %s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggerStructured(t *testing.T) {
+	var out bytes.Buffer
+	r := New()
+	r.Use(RequestID())
+	r.Use(LoggerWithConfig(LoggerConfig{
+		Logger:    slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		SkipPaths: []string{"/health"},
+	}))
+	r.GET("/health", func(c *Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/users/:id", func(c *Context) {
+		c.SetLogAttrs(slog.String("tenant", "acme"))
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/missing", func(c *Context) { c.String(http.StatusNotFound, "missing") })
+	r.GET("/broken", func(c *Context) { c.String(http.StatusInternalServerError, "broken") })
+
+	tests := []struct {
+		path      string
+		wantLevel string
+		skipped   bool
+	}{
+		{"/health", "", true},
+		{"/users/1", "INFO", false},
+		{"/missing", "WARN", false},
+		{"/broken", "ERROR", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			out.Reset()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if tt.skipped {
+				if out.Len() != 0 {
+					t.Errorf("log = %q, want no record", out.String())
+				}
+				return
+			}
+
+			var record map[string]interface{}
+			if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+				t.Fatalf("log = %q: %v", out.String(), err)
+			}
+			if record["level"] != tt.wantLevel {
+				t.Errorf("level = %v, want %s", record["level"], tt.wantLevel)
+			}
+			if record["path"] != tt.path || record["status"] != float64(w.Code) {
+				t.Errorf("path, status = %v, %v, want %s, %d", record["path"], record["status"], tt.path, w.Code)
+			}
+			if record["request_id"] != w.Header().Get("X-Request-ID") {
+				t.Errorf("request_id = %v, want %s", record["request_id"], w.Header().Get("X-Request-ID"))
+			}
+			if tt.path == "/users/1" && (record["route"] != "/users/:id" || record["tenant"] != "acme") {
+				t.Errorf("route, tenant = %v, %v, want /users/:id, acme", record["route"], record["tenant"])
+			}
+		})
+	}
+}
+
+func TestLoggerSampling(t *testing.T) {
+	var out bytes.Buffer
+	r := New()
+	r.Use(LoggerWithConfig(LoggerConfig{
+		Logger:     slog.New(slog.NewTextHandler(&out, nil)),
+		SampleRate: 1e-9,
+		Level: func(status int) slog.Level {
+			return slog.LevelInfo
+		},
+	}))
+	r.GET("/ok", func(c *Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/bad", func(c *Context) { c.String(http.StatusBadRequest, "bad") })
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if out.Len() != 0 {
+		t.Errorf("log = %q, want the successful request sampled out", out.String())
+	}
+
+	// Errors are always logged, with the level from the config
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/bad", nil))
+	if !strings.Contains(out.String(), "level=INFO") || !strings.Contains(out.String(), "status=400") {
+		t.Errorf("log = %q, want the failed request at INFO", out.String())
+	}
+}
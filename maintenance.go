@@ -0,0 +1,130 @@
+package aqylly
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaintenanceConfig holds the configuration of maintenance mode
+type MaintenanceConfig struct {
+	// RetryAfter is sent in the Retry-After header (default: 5m)
+	RetryAfter time.Duration
+
+	// Until is the expected end of the maintenance. When set it is sent
+	// in the Retry-After header instead of RetryAfter.
+	Until time.Time
+
+	// Message is included in the JSON response
+	Message string
+
+	// HTML is served to clients that accept text/html instead of JSON
+	HTML string
+
+	// AllowPaths lists paths that keep working, such as health checks and
+	// the maintenance admin endpoint. A trailing '*' matches a prefix.
+	AllowPaths []string
+
+	// AllowIPs lists clients that keep full access
+	AllowIPs *IPList
+}
+
+// EnableMaintenance puts the router in maintenance mode. Requests are
+// answered with 503 and Retry-After, except for the allowed paths and
+// clients. Global middleware still runs. It is safe to call while serving.
+func (r *Router) EnableMaintenance(config MaintenanceConfig) {
+	if config.RetryAfter <= 0 {
+		config.RetryAfter = 5 * time.Minute
+	}
+	r.maintenance.Store(&config)
+}
+
+// DisableMaintenance leaves maintenance mode
+func (r *Router) DisableMaintenance() {
+	r.maintenance.Store(nil)
+}
+
+// InMaintenance reports whether the router is in maintenance mode
+func (r *Router) InMaintenance() bool {
+	return r.maintenance.Load() != nil
+}
+
+// MaintenanceHandler returns an admin handler for maintenance mode. GET
+// reports the state, POST and PUT enable it with an optional JSON body
+// ({"retry_after": seconds, "message": "..."}) and DELETE disables it.
+// Keep the handler's path in AllowPaths and protect it with middleware.
+func (r *Router) MaintenanceHandler(base MaintenanceConfig) HandlerFunc {
+	return func(c *Context) {
+		switch c.Method() {
+		case http.MethodPost, http.MethodPut:
+			var body struct {
+				RetryAfter int    `json:"retry_after"`
+				Message    string `json:"message"`
+			}
+			if c.Request.ContentLength != 0 {
+				if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+					c.JSON(http.StatusBadRequest, map[string]string{
+						"error": "invalid JSON body",
+					})
+					return
+				}
+			}
+
+			config := base
+			if body.RetryAfter > 0 {
+				config.RetryAfter = time.Duration(body.RetryAfter) * time.Second
+			}
+			if body.Message != "" {
+				config.Message = body.Message
+			}
+			r.EnableMaintenance(config)
+
+		case http.MethodDelete:
+			r.DisableMaintenance()
+		}
+
+		c.JSON(http.StatusOK, map[string]bool{
+			"maintenance": r.InMaintenance(),
+		})
+	}
+}
+
+// maintenanceAllows reports whether a request may bypass maintenance mode
+func maintenanceAllows(c *Context, config *MaintenanceConfig) bool {
+	if matchPath(config.AllowPaths, c.Path()) {
+		return true
+	}
+	if config.AllowIPs != nil {
+		if addr, ok := parseIP(c.ClientIP()); ok && config.AllowIPs.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceHandler answers requests during maintenance
+func maintenanceHandler(config *MaintenanceConfig) HandlerFunc {
+	return func(c *Context) {
+		if !config.Until.IsZero() {
+			c.SetHeader("Retry-After", config.Until.UTC().Format(http.TimeFormat))
+		} else {
+			c.SetHeader("Retry-After", strconv.Itoa(int(config.RetryAfter.Seconds())))
+		}
+		c.SetHeader("Cache-Control", "no-store")
+
+		if config.HTML != "" && strings.Contains(c.Header("Accept"), "text/html") {
+			c.HTML(http.StatusServiceUnavailable, config.HTML)
+			return
+		}
+
+		response := map[string]string{
+			"error": "Service Unavailable",
+		}
+		if config.Message != "" {
+			response["message"] = config.Message
+		}
+		c.JSON(http.StatusServiceUnavailable, response)
+	}
+}
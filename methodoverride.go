@@ -0,0 +1,73 @@
+package aqylly
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// MethodOverrideConfig holds the configuration for the MethodOverride middleware
+type MethodOverrideConfig struct {
+	// Header carries the method (default: "X-HTTP-Method-Override")
+	Header string
+
+	// FormField carries the method in form bodies (default: "_method")
+	FormField string
+
+	// Methods lists the methods a POST may be turned into (default: PUT, PATCH, DELETE)
+	Methods []string
+}
+
+// MethodOverride returns a pre-routing middleware that lets POST requests
+// choose PUT, PATCH or DELETE. Register it with Router.Pre.
+func MethodOverride() HandlerFunc {
+	return MethodOverrideWithConfig(MethodOverrideConfig{})
+}
+
+// MethodOverrideWithConfig returns a pre-routing middleware that replaces the
+// method of POST requests with the one in the override header or, for form
+// bodies, the override form field. Methods that are not allowed are ignored.
+// Register it with Router.Pre so the route is looked up with the new method.
+func MethodOverrideWithConfig(config MethodOverrideConfig) HandlerFunc {
+	if config.Header == "" {
+		config.Header = "X-HTTP-Method-Override"
+	}
+	if config.FormField == "" {
+		config.FormField = "_method"
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+
+	allowed := make(map[string]bool, len(config.Methods))
+	for _, method := range config.Methods {
+		allowed[strings.ToUpper(method)] = true
+	}
+
+	return func(c *Context) {
+		if c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+
+		method := c.Header(config.Header)
+		if method == "" && isFormContentType(c.ContentType()) {
+			method = c.Request.PostFormValue(config.FormField)
+		}
+
+		if method = strings.ToUpper(strings.TrimSpace(method)); allowed[method] {
+			c.Request.Method = method
+		}
+
+		c.Next()
+	}
+}
+
+// isFormContentType reports whether the body is a URL-encoded or multipart form
+func isFormContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data"
+}
@@ -0,0 +1,74 @@
+package aqylly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMethodOverride(t *testing.T) {
+	r := New()
+	r.Pre(MethodOverride())
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		r.addRoute(method, "/items/:id", func(c *Context) {
+			c.String(http.StatusOK, "%s %s", c.Method(), c.Param("id"))
+		})
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		header      string
+		form        string
+		contentType string
+		want        string
+	}{
+		{"header", http.MethodPost, "PUT", "", "", "PUT 1"},
+		{"lowercase header", http.MethodPost, " delete ", "", "", "DELETE 1"},
+		{"form field", http.MethodPost, "", "_method=DELETE", "application/x-www-form-urlencoded", "DELETE 1"},
+		{"form field needs a form body", http.MethodPost, "", "_method=DELETE", "text/plain", "POST 1"},
+		{"header wins over form", http.MethodPost, "PUT", "_method=DELETE", "application/x-www-form-urlencoded", "PUT 1"},
+		{"method not allowed", http.MethodPost, "GET", "", "", "POST 1"},
+		{"only post is overridden", http.MethodGet, "DELETE", "", "", "GET 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/items/1", strings.NewReader(tt.form))
+			if tt.header != "" {
+				req.Header.Set("X-HTTP-Method-Override", tt.header)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK || w.Body.String() != tt.want {
+				t.Errorf("got %d %q, want 200 %q", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMethodOverrideRouteLookup(t *testing.T) {
+	r := New()
+	r.Pre(MethodOverride())
+	r.DELETE("/items/:id", func(c *Context) { c.String(http.StatusOK, "deleted") })
+
+	// Without the override the POST would be a 405
+	req := httptest.NewRequest(http.MethodPost, "/items/1", nil)
+	req.Header.Set("X-HTTP-Method-Override", "DELETE")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "deleted" {
+		t.Errorf("got %d %q, want 200 deleted", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items/1", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,272 @@
+package aqylly
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the latency histogram buckets in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// sizeBuckets are the response size histogram buckets in bytes
+var sizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// metrics holds the HTTP metrics recorded by the Metrics middleware
+type metrics struct {
+	mu       sync.RWMutex
+	series   map[metricLabels]*metricSeries
+	inFlight atomic.Int64
+}
+
+// metricLabels identifies a series
+type metricLabels struct {
+	method string
+	route  string
+	status string
+}
+
+// metricSeries holds the values of one label set
+type metricSeries struct {
+	mu       sync.Mutex
+	requests uint64
+	latency  histogram
+	size     histogram
+}
+
+// histogram is a cumulative histogram in the Prometheus format
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// observe records a value
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	for i, upper := range buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// clone returns a copy of the histogram
+func (h *histogram) clone() histogram {
+	return histogram{
+		counts: append([]uint64(nil), h.counts...),
+		sum:    h.sum,
+		count:  h.count,
+	}
+}
+
+// newMetrics creates an empty metrics registry
+func newMetrics() *metrics {
+	return &metrics{series: make(map[metricLabels]*metricSeries)}
+}
+
+// observe records a finished request
+func (m *metrics) observe(labels metricLabels, latency time.Duration, size int) {
+	m.mu.RLock()
+	s := m.series[labels]
+	m.mu.RUnlock()
+
+	if s == nil {
+		m.mu.Lock()
+		if s = m.series[labels]; s == nil {
+			s = &metricSeries{}
+			m.series[labels] = s
+		}
+		m.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	s.requests++
+	s.latency.observe(latencyBuckets, latency.Seconds())
+	s.size.observe(sizeBuckets, float64(size))
+	s.mu.Unlock()
+}
+
+// metricMethod returns the method label, folding non-standard methods into
+// "other" so clients cannot create series at will
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// Metrics returns a middleware that records request counts, latency,
+// in-flight requests and response sizes labeled by method, route pattern
+// and status. Use Router.MetricsHandler to expose them.
+func Metrics() HandlerFunc {
+	return func(c *Context) {
+		if c.router == nil || c.router.metrics == nil {
+			c.Next()
+			return
+		}
+
+		m := c.router.metrics
+		m.inFlight.Add(1)
+		start := time.Now()
+
+		defer func() {
+			m.inFlight.Add(-1)
+
+			route := c.Route()
+			if route == "" {
+				route = "unmatched"
+			}
+			m.observe(metricLabels{
+				method: metricMethod(c.Method()),
+				route:  route,
+				status: strconv.Itoa(c.writer.status),
+			}, time.Since(start), c.writer.size)
+		}()
+
+		c.Next()
+	}
+}
+
+// MetricsHandler returns a handler that exposes the metrics recorded by
+// the Metrics middleware in the Prometheus text exposition format
+func (r *Router) MetricsHandler() HandlerFunc {
+	if r.metrics == nil {
+		r.metrics = newMetrics()
+	}
+
+	return func(c *Context) {
+		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", r.metrics.render())
+	}
+}
+
+// render writes all metrics in the Prometheus text exposition format
+func (m *metrics) render() []byte {
+	m.mu.RLock()
+	keys := make([]metricLabels, 0, len(m.series))
+	series := make(map[metricLabels]*metricSeries, len(m.series))
+	for k, s := range m.series {
+		keys = append(keys, k)
+		series[k] = s
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	// Take a consistent copy of every series
+	snapshots := make([]metricSeries, len(keys))
+	for i, k := range keys {
+		s := series[k]
+		s.mu.Lock()
+		snapshots[i].requests = s.requests
+		snapshots[i].latency = s.latency.clone()
+		snapshots[i].size = s.size.clone()
+		s.mu.Unlock()
+	}
+
+	var buf bytes.Buffer
+
+	writeMetricHeader(&buf, "http_requests_total", "counter", "Total number of HTTP requests.")
+	for i, k := range keys {
+		buf.WriteString("http_requests_total")
+		writeLabels(&buf, k, "")
+		buf.WriteString(" " + strconv.FormatUint(snapshots[i].requests, 10) + "\n")
+	}
+
+	writeMetricHeader(&buf, "http_request_duration_seconds", "histogram", "HTTP request latency in seconds.")
+	for i, k := range keys {
+		writeHistogram(&buf, "http_request_duration_seconds", k, latencyBuckets, &snapshots[i].latency)
+	}
+
+	writeMetricHeader(&buf, "http_response_size_bytes", "histogram", "HTTP response size in bytes.")
+	for i, k := range keys {
+		writeHistogram(&buf, "http_response_size_bytes", k, sizeBuckets, &snapshots[i].size)
+	}
+
+	writeMetricHeader(&buf, "http_requests_in_flight", "gauge", "Number of HTTP requests being served.")
+	buf.WriteString("http_requests_in_flight " + strconv.FormatInt(m.inFlight.Load(), 10) + "\n")
+
+	return buf.Bytes()
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric
+func writeMetricHeader(buf *bytes.Buffer, name, typ, help string) {
+	buf.WriteString("# HELP " + name + " " + help + "\n")
+	buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// writeHistogram writes the buckets, sum and count of a histogram
+func writeHistogram(buf *bytes.Buffer, name string, labels metricLabels, buckets []float64, h *histogram) {
+	for i, upper := range buckets {
+		var count uint64
+		if h.counts != nil {
+			count = h.counts[i]
+		}
+		buf.WriteString(name + "_bucket")
+		writeLabels(buf, labels, formatFloat(upper))
+		buf.WriteString(" " + strconv.FormatUint(count, 10) + "\n")
+	}
+
+	buf.WriteString(name + "_bucket")
+	writeLabels(buf, labels, "+Inf")
+	buf.WriteString(" " + strconv.FormatUint(h.count, 10) + "\n")
+
+	buf.WriteString(name + "_sum")
+	writeLabels(buf, labels, "")
+	buf.WriteString(" " + formatFloat(h.sum) + "\n")
+
+	buf.WriteString(name + "_count")
+	writeLabels(buf, labels, "")
+	buf.WriteString(" " + strconv.FormatUint(h.count, 10) + "\n")
+}
+
+// writeLabels writes a label set, with an optional "le" label
+func writeLabels(buf *bytes.Buffer, labels metricLabels, le string) {
+	buf.WriteString(`{method="` + escapeLabel(labels.method) +
+		`",route="` + escapeLabel(labels.route) +
+		`",status="` + escapeLabel(labels.status) + `"`)
+	if le != "" {
+		buf.WriteString(`,le="` + le + `"`)
+	}
+	buf.WriteByte('}')
+}
+
+// labelEscaper escapes label values for the text exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// formatFloat formats a sample value
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,258 @@
+package aqylly
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// ProxyHeader selects the forwarding headers honored from trusted proxies
+type ProxyHeader int
+
+const (
+	// ProxyHeaderXForwarded honors X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host
+	ProxyHeaderXForwarded ProxyHeader = iota
+
+	// ProxyHeaderForwarded honors the RFC 7239 Forwarded header
+	ProxyHeaderForwarded
+)
+
+// SetTrustedProxies parses IP addresses and CIDR ranges into Router.TrustedProxies
+func (r *Router) SetTrustedProxies(proxies ...string) error {
+	prefixes, err := parsePrefixes(proxies)
+	if err != nil {
+		return err
+	}
+
+	r.TrustedProxies = prefixes
+	return nil
+}
+
+// parsePrefixes parses IP addresses and CIDR ranges; addresses become single-address prefixes
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+				prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// isTrustedProxy reports whether the address belongs to a trusted proxy
+func (r *Router) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range r.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteAddr returns the IP address of the direct peer
+func (c *Context) remoteAddr() (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		host = c.Request.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// fromTrustedProxy reports whether the direct peer is a trusted proxy
+func (c *Context) fromTrustedProxy() bool {
+	if c.router == nil || len(c.router.TrustedProxies) == 0 {
+		return false
+	}
+	addr, ok := c.remoteAddr()
+	return ok && c.router.isTrustedProxy(addr)
+}
+
+// ClientIP returns the client IP address.
+//
+// Forwarding headers are only honored when the request comes from one of
+// Router.TrustedProxies. If Router.ClientIPHeader is set, only that header
+// is read. Otherwise the header selected by Router.ProxyHeader is walked
+// from right to left, skipping trusted proxies.
+func (c *Context) ClientIP() string {
+	remote, ok := c.remoteAddr()
+	if !ok {
+		return c.Request.RemoteAddr
+	}
+
+	if !c.fromTrustedProxy() {
+		return remote.String()
+	}
+
+	if header := c.router.ClientIPHeader; header != "" {
+		if addr, ok := parseIP(c.Header(header)); ok {
+			return addr.String()
+		}
+		return remote.String()
+	}
+
+	if c.router.ProxyHeader == ProxyHeaderForwarded {
+		if element, ok := c.forwardedClient(); ok {
+			if addr, ok := parseNode(element["for"]); ok {
+				return addr.String()
+			}
+		}
+		return remote.String()
+	}
+
+	if values := c.Request.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		hops := strings.Split(strings.Join(values, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, ok := parseIP(hops[i])
+			if !ok {
+				break
+			}
+			if i == 0 || !c.router.isTrustedProxy(addr) {
+				return addr.String()
+			}
+		}
+	}
+
+	return remote.String()
+}
+
+// Scheme returns the request scheme ("http" or "https").
+// X-Forwarded-Proto or Forwarded, as selected by Router.ProxyHeader,
+// is honored for trusted proxies.
+func (c *Context) Scheme() string {
+	if c.fromTrustedProxy() {
+		if c.router.ProxyHeader == ProxyHeaderForwarded {
+			if element, ok := c.forwardedClient(); ok && element["proto"] != "" {
+				return strings.ToLower(element["proto"])
+			}
+		} else if proto := lastValue(c.Header("X-Forwarded-Proto")); proto != "" {
+			return strings.ToLower(proto)
+		}
+	}
+
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Host returns the request host.
+// X-Forwarded-Host or Forwarded, as selected by Router.ProxyHeader,
+// is honored for trusted proxies.
+func (c *Context) Host() string {
+	if c.fromTrustedProxy() {
+		if c.router.ProxyHeader == ProxyHeaderForwarded {
+			if element, ok := c.forwardedClient(); ok && element["host"] != "" {
+				return element["host"]
+			}
+		} else if host := lastValue(c.Header("X-Forwarded-Host")); host != "" {
+			return host
+		}
+	}
+
+	return c.Request.Host
+}
+
+// forwardedClient walks the Forwarded elements from right to left and
+// returns the element added by the first proxy that saw the untrusted client
+func (c *Context) forwardedClient() (map[string]string, bool) {
+	elements := parseForwarded(c.Request.Header.Values("Forwarded"))
+	for i := len(elements) - 1; i >= 0; i-- {
+		addr, ok := parseNode(elements[i]["for"])
+		if !ok {
+			// Obfuscated or unknown node: stop walking
+			return elements[i], true
+		}
+		if i == 0 || !c.router.isTrustedProxy(addr) {
+			return elements[i], true
+		}
+	}
+	return nil, false
+}
+
+// parseForwarded parses Forwarded header values (RFC 7239)
+func parseForwarded(values []string) []map[string]string {
+	var elements []map[string]string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			pairs := make(map[string]string)
+			for _, pair := range splitQuoted(element, ';') {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				val = strings.TrimSpace(val)
+				if len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"' {
+					val = strings.ReplaceAll(val[1:len(val)-1], `\"`, `"`)
+				}
+				pairs[strings.ToLower(strings.TrimSpace(key))] = val
+			}
+			elements = append(elements, pairs)
+		}
+	}
+	return elements
+}
+
+// splitQuoted splits s by sep, ignoring separators inside quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseNode parses a Forwarded node such as 192.0.2.1, 192.0.2.1:80 or [2001:db8::1]:80
+func parseNode(node string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	return parseIP(strings.Trim(node, "[]"))
+}
+
+// parseIP parses an IP address, ignoring surrounding spaces
+func parseIP(s string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// lastValue returns the last element of a comma-separated header value,
+// which is the one set by the nearest proxy
+func lastValue(value string) string {
+	if i := strings.LastIndexByte(value, ','); i != -1 {
+		value = value[i+1:]
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,159 @@
+package aqylly
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// proxyContext returns a Context for a request from remoteAddr to a router
+// that trusts 10.0.0.0/8 and ::1
+func proxyContext(t *testing.T, remoteAddr string, header http.Header) *Context {
+	t.Helper()
+	r := New()
+	if err := r.SetTrustedProxies("10.0.0.0/8", "::1"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	c := &Context{router: r}
+	c.reset(httptest.NewRecorder(), req)
+	return c
+}
+
+func TestClientIP(t *testing.T) {
+	const (
+		xff = ProxyHeaderXForwarded
+		fwd = ProxyHeaderForwarded
+	)
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		header       http.Header
+		proxyHeader  ProxyHeader
+		clientHeader string
+		want         string
+	}{
+		{"direct", "203.0.113.5:1234", nil, xff, "", "203.0.113.5"},
+		{"untrusted peer", "203.0.113.5:1234", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, xff, "", "203.0.113.5"},
+		{"untrusted peer forwarded", "203.0.113.5:1234", http.Header{"Forwarded": {"for=1.2.3.4"}}, fwd, "", "203.0.113.5"},
+		{"no port", "203.0.113.5", nil, xff, "", "203.0.113.5"},
+		{"mapped peer", "[::ffff:10.0.0.1]:80", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, xff, "", "1.2.3.4"},
+		{"ipv6 proxy", "[::1]:80", http.Header{"X-Forwarded-For": {"2001:db8::1"}}, xff, "", "2001:db8::1"},
+
+		{"x-forwarded-for", "10.0.0.1:80", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, xff, "", "1.2.3.4"},
+		{"x-forwarded-for skips proxies", "10.0.0.1:80", http.Header{"X-Forwarded-For": {"1.2.3.4, 10.0.0.2"}}, xff, "", "1.2.3.4"},
+		{"x-forwarded-for spoofed hop", "10.0.0.1:80", http.Header{"X-Forwarded-For": {"6.6.6.6, 1.2.3.4"}}, xff, "", "1.2.3.4"},
+		{"x-forwarded-for lines", "10.0.0.1:80", http.Header{"X-Forwarded-For": {"6.6.6.6", "1.2.3.4"}}, xff, "", "1.2.3.4"},
+		{"x-forwarded-for only proxies", "10.0.0.1:80", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, xff, "", "10.0.0.3"},
+		{"x-forwarded-for garbage", "10.0.0.1:80", http.Header{"X-Forwarded-For": {"garbage"}}, xff, "", "10.0.0.1"},
+		{"client forwarded next to proxy x-forwarded-for", "10.0.0.1:80", http.Header{"Forwarded": {"for=6.6.6.6"}, "X-Forwarded-For": {"203.0.113.7"}}, xff, "", "203.0.113.7"},
+		{"x-real-ip ignored", "10.0.0.1:80", http.Header{"X-Real-Ip": {"1.2.3.4"}}, xff, "", "10.0.0.1"},
+
+		{"forwarded", "10.0.0.1:80", http.Header{"Forwarded": {"for=192.0.2.60;proto=https;by=10.0.0.1"}}, fwd, "", "192.0.2.60"},
+		{"forwarded ipv6", "10.0.0.1:80", http.Header{"Forwarded": {`for="[2001:db8::1]:4711"`}}, fwd, "", "2001:db8::1"},
+		{"forwarded skips proxies", "10.0.0.1:80", http.Header{"Forwarded": {"for=198.51.100.1, for=10.0.0.2"}}, fwd, "", "198.51.100.1"},
+		{"forwarded spoofed hop", "10.0.0.1:80", http.Header{"Forwarded": {"for=6.6.6.6, for=198.51.100.1"}}, fwd, "", "198.51.100.1"},
+		{"forwarded case", "10.0.0.1:80", http.Header{"Forwarded": {"For=192.0.2.60"}}, fwd, "", "192.0.2.60"},
+		{"client x-forwarded-for next to proxy forwarded", "10.0.0.1:80", http.Header{"Forwarded": {"for=192.0.2.60"}, "X-Forwarded-For": {"6.6.6.6"}}, fwd, "", "192.0.2.60"},
+		{"forwarded obfuscated", "10.0.0.1:80", http.Header{"Forwarded": {"for=_hidden"}, "X-Forwarded-For": {"1.2.3.4"}}, fwd, "", "10.0.0.1"},
+
+		{"x-real-ip header", "10.0.0.1:80", http.Header{"X-Real-Ip": {"1.2.3.4"}}, xff, "X-Real-IP", "1.2.3.4"},
+		{"client ip header", "10.0.0.1:80", http.Header{"Cf-Connecting-Ip": {"1.2.3.4"}, "X-Forwarded-For": {"5.6.7.8"}}, xff, "CF-Connecting-IP", "1.2.3.4"},
+		{"client ip header invalid", "10.0.0.1:80", http.Header{"Cf-Connecting-Ip": {"bad"}, "X-Forwarded-For": {"5.6.7.8"}}, xff, "CF-Connecting-IP", "10.0.0.1"},
+		{"client ip header untrusted", "203.0.113.5:1234", http.Header{"Cf-Connecting-Ip": {"1.2.3.4"}}, xff, "CF-Connecting-IP", "203.0.113.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := proxyContext(t, tt.remoteAddr, tt.header)
+			c.router.ProxyHeader = tt.proxyHeader
+			c.router.ClientIPHeader = tt.clientHeader
+
+			if got := c.ClientIP(); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemeAndHost(t *testing.T) {
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		header      http.Header
+		proxyHeader ProxyHeader
+		tls         bool
+		scheme      string
+		host        string
+	}{
+		{"direct", "203.0.113.5:1234", nil, ProxyHeaderXForwarded, false, "http", "example.com"},
+		{"direct tls", "203.0.113.5:1234", nil, ProxyHeaderXForwarded, true, "https", "example.com"},
+		{"untrusted peer", "203.0.113.5:1234", http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"evil.example"}}, ProxyHeaderXForwarded, false, "http", "example.com"},
+		{"x-forwarded", "10.0.0.1:80", http.Header{"X-Forwarded-Proto": {"HTTPS"}, "X-Forwarded-Host": {"api.example.org"}}, ProxyHeaderXForwarded, false, "https", "api.example.org"},
+		{"x-forwarded nearest proxy", "10.0.0.1:80", http.Header{"X-Forwarded-Proto": {"http, https"}, "X-Forwarded-Host": {"evil.example, api.example.org"}}, ProxyHeaderXForwarded, false, "https", "api.example.org"},
+		{"client forwarded ignored", "10.0.0.1:80", http.Header{"Forwarded": {"proto=https;host=evil.example"}}, ProxyHeaderXForwarded, false, "http", "example.com"},
+		{"forwarded", "10.0.0.1:80", http.Header{"Forwarded": {`for=192.0.2.60;proto=https;host="api.example.org:8443"`}}, ProxyHeaderForwarded, false, "https", "api.example.org:8443"},
+		{"client x-forwarded ignored", "10.0.0.1:80", http.Header{"Forwarded": {"for=192.0.2.60;proto=https;host=a.example"}, "X-Forwarded-Proto": {"http"}, "X-Forwarded-Host": {"b.example"}}, ProxyHeaderForwarded, false, "https", "a.example"},
+		{"forwarded without proto", "10.0.0.1:80", http.Header{"Forwarded": {"for=192.0.2.60"}, "X-Forwarded-Proto": {"https"}}, ProxyHeaderForwarded, false, "http", "example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := proxyContext(t, tt.remoteAddr, tt.header)
+			c.router.ProxyHeader = tt.proxyHeader
+			if tt.tls {
+				c.Request.TLS = &tls.ConnectionState{}
+			}
+
+			if got := c.Scheme(); got != tt.scheme {
+				t.Errorf("Scheme() = %q, want %q", got, tt.scheme)
+			}
+			if got := c.Host(); got != tt.host {
+				t.Errorf("Host() = %q, want %q", got, tt.host)
+			}
+		})
+	}
+}
+
+func TestParseForwarded(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []map[string]string
+	}{
+		{"single", []string{"for=192.0.2.60"}, []map[string]string{{"for": "192.0.2.60"}}},
+		{"pairs", []string{"for=192.0.2.60;proto=http;by=203.0.113.43"},
+			[]map[string]string{{"for": "192.0.2.60", "proto": "http", "by": "203.0.113.43"}}},
+		{"elements", []string{"for=192.0.2.43, for=198.51.100.17"},
+			[]map[string]string{{"for": "192.0.2.43"}, {"for": "198.51.100.17"}}},
+		{"lines", []string{"for=192.0.2.43", "for=198.51.100.17"},
+			[]map[string]string{{"for": "192.0.2.43"}, {"for": "198.51.100.17"}}},
+		{"quoted", []string{`for="[2001:db8:cafe::17]:4711"`},
+			[]map[string]string{{"for": "[2001:db8:cafe::17]:4711"}}},
+		{"quoted separators", []string{`for=192.0.2.60;host="a,b;c"`},
+			[]map[string]string{{"for": "192.0.2.60", "host": "a,b;c"}}},
+		{"escaped quote", []string{`for=192.0.2.60;host="a\"b"`},
+			[]map[string]string{{"for": "192.0.2.60", "host": `a"b`}}},
+		{"case and spaces", []string{" For = 192.0.2.60 ; PROTO=https"},
+			[]map[string]string{{"for": "192.0.2.60", "proto": "https"}}},
+		{"pair without value", []string{"for=192.0.2.60;secret"},
+			[]map[string]string{{"for": "192.0.2.60"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseForwarded(tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseForwarded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package aqylly
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"syscall"
+)
+
+// RecoveryConfig holds the configuration for the Recovery middleware
+type RecoveryConfig struct {
+	// Handler writes the response for a recovered panic. It is not called
+	// when the response has already been started or the client went away.
+	// The default responds with a generic 500 JSON error.
+	Handler func(c *Context, err interface{})
+
+	// StackSize is the maximum size of the logged stack trace in bytes
+	// (default: 4 KB). A negative value disables stack traces.
+	StackSize int
+
+	// Logger receives panic records (default: the request logger)
+	Logger *slog.Logger
+
+	// Reporter is called with the panic value and stack trace,
+	// for example to send the panic to an error tracker
+	Reporter func(c *Context, err interface{}, stack []byte)
+}
+
+// Recovery returns a middleware that recovers from panics
+func Recovery() HandlerFunc {
+	return RecoveryWithConfig(RecoveryConfig{})
+}
+
+// RecoveryWithConfig returns a middleware that recovers from panics, logs
+// them and responds with 500. http.ErrAbortHandler is re-panicked so the
+// server aborts the response, and panics caused by a broken connection are
+// logged without a stack trace or response.
+func RecoveryWithConfig(config RecoveryConfig) HandlerFunc {
+	if config.Handler == nil {
+		config.Handler = defaultRecoveryHandler
+	}
+	if config.StackSize == 0 {
+		config.StackSize = 4 << 10
+	}
+
+	return func(c *Context) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			logger := config.Logger
+			if logger == nil {
+				logger = c.Logger()
+			}
+
+			if isBrokenPipe(err) {
+				logger.Warn("client connection closed", slog.Any("error", err))
+				c.Abort()
+				return
+			}
+
+			var stack []byte
+			if config.StackSize > 0 {
+				stack = make([]byte, config.StackSize)
+				stack = stack[:runtime.Stack(stack, false)]
+			}
+
+			attrs := []interface{}{slog.Any("error", err)}
+			if stack != nil {
+				attrs = append(attrs, slog.String("stack", string(stack)))
+			}
+			logger.Error("panic recovered", attrs...)
+
+			if config.Reporter != nil {
+				config.Reporter(c, err, stack)
+			}
+
+			if c.writer.written {
+				// The status line is already on the wire
+				c.Abort()
+				return
+			}
+			config.Handler(c, err)
+			c.Abort()
+		}()
+
+		c.Next()
+	}
+}
+
+// defaultRecoveryHandler responds with a 500 that does not reveal the panic value
+func defaultRecoveryHandler(c *Context, err interface{}) {
+	response := map[string]interface{}{
+		"error": "Internal Server Error",
+	}
+	if requestID := c.RequestID(); requestID != "" {
+		response["request_id"] = requestID
+	}
+	c.AbortWithJSON(http.StatusInternalServerError, response)
+}
+
+// isBrokenPipe reports whether the panic was caused by the client closing the connection
+func isBrokenPipe(err interface{}) bool {
+	e, ok := err.(error)
+	if !ok {
+		return false
+	}
+	return errors.Is(e, syscall.EPIPE) || errors.Is(e, syscall.ECONNRESET)
+}
@@ -0,0 +1,155 @@
+package aqylly
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       HandlerFunc
+		stackSize     int
+		wantStatus    int
+		wantBody      string
+		wantRequestID bool
+		wantReport    bool
+		wantStack     bool
+		wantLog       string
+	}{
+		{
+			name:          "panic value is not leaked",
+			handler:       func(c *Context) { panic("password=hunter2") },
+			wantStatus:    http.StatusInternalServerError,
+			wantBody:      `"error":"Internal Server Error"`,
+			wantRequestID: true,
+			wantReport:    true,
+			wantStack:     true,
+			wantLog:       "panic recovered",
+		},
+		{
+			name:          "stack disabled",
+			handler:       func(c *Context) { panic("boom") },
+			stackSize:     -1,
+			wantStatus:    http.StatusInternalServerError,
+			wantBody:      `"error":"Internal Server Error"`,
+			wantRequestID: true,
+			wantReport:    true,
+			wantLog:       "panic recovered",
+		},
+		{
+			name: "response already started",
+			handler: func(c *Context) {
+				c.String(http.StatusOK, "partial")
+				panic("boom")
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "partial",
+			wantReport: true,
+			wantStack:  true,
+			wantLog:    "panic recovered",
+		},
+		{
+			name:       "broken pipe",
+			handler:    func(c *Context) { panic(fmt.Errorf("write: %w", syscall.EPIPE)) },
+			wantStatus: http.StatusOK,
+			wantLog:    "client connection closed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			var reported bool
+			var stack []byte
+
+			r := New()
+			r.Use(RequestID())
+			r.Use(RecoveryWithConfig(RecoveryConfig{
+				StackSize: tt.stackSize,
+				Logger:    slog.New(slog.NewTextHandler(&logs, nil)),
+				Reporter: func(c *Context, err interface{}, s []byte) {
+					reported = true
+					stack = s
+				},
+			}))
+			r.GET("/", tt.handler)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			body := w.Body.String()
+			if tt.wantBody == "" && body != "" || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if strings.Contains(body, "hunter2") || strings.Contains(body, "boom") {
+				t.Errorf("body = %q leaks the panic value", body)
+			}
+			if tt.wantRequestID && !strings.Contains(body, w.Header().Get("X-Request-ID")) {
+				t.Errorf("body = %q, want the request ID", body)
+			}
+			if reported != tt.wantReport {
+				t.Errorf("reported = %v, want %v", reported, tt.wantReport)
+			}
+			if (len(stack) > 0) != tt.wantStack {
+				t.Errorf("stack = %d bytes, want stack %v", len(stack), tt.wantStack)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log = %q, want %q", logs.String(), tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestRecoveryCustomHandler(t *testing.T) {
+	var got interface{}
+	r := New()
+	r.Use(RecoveryWithConfig(RecoveryConfig{
+		Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
+		Handler: func(c *Context, err interface{}) {
+			got = err
+			c.String(http.StatusBadGateway, "custom")
+		},
+	}))
+	r.GET("/", func(c *Context) { panic("boom") })
+	r.GET("/partial", func(c *Context) {
+		c.String(http.StatusOK, "partial")
+		panic("late")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusBadGateway || w.Body.String() != "custom" || got != "boom" {
+		t.Errorf("got %d %q %v, want the custom handler response", w.Code, w.Body.String(), got)
+	}
+
+	// The handler is not called once the response has started
+	got = nil
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/partial", nil))
+	if w.Body.String() != "partial" || got != nil {
+		t.Errorf("got %q %v, want only the partial response", w.Body.String(), got)
+	}
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	r := New()
+	r.Use(Recovery())
+	r.GET("/", func(c *Context) { panic(http.ErrAbortHandler) })
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", err)
+		}
+	}()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
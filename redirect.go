@@ -0,0 +1,110 @@
+package aqylly
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RedirectConfig holds the configuration for the Redirect middleware
+type RedirectConfig struct {
+	// HTTPS redirects plain HTTP requests to HTTPS
+	HTTPS bool
+
+	// HTTPSPort is the port of the HTTPS server when it is not 443
+	HTTPSPort int
+
+	// Host is the canonical host, such as "example.com" or "www.example.com".
+	// Requests for other hosts are redirected to it. Empty keeps the host.
+	Host string
+
+	// Temporary uses 302 and 307 instead of 301 and 308
+	Temporary bool
+
+	// ExemptPaths lists paths that are never redirected, such as ACME
+	// challenges. A trailing '*' matches a prefix.
+	ExemptPaths []string
+}
+
+// HTTPSRedirect returns a middleware that redirects HTTP requests to HTTPS
+func HTTPSRedirect() HandlerFunc {
+	return RedirectWithConfig(RedirectConfig{HTTPS: true})
+}
+
+// CanonicalHost returns a middleware that redirects requests to the canonical host
+func CanonicalHost(host string) HandlerFunc {
+	return RedirectWithConfig(RedirectConfig{Host: host})
+}
+
+// RedirectWithConfig returns a middleware that redirects to HTTPS and/or the
+// canonical host, preserving the path and query. The scheme and host come
+// from c.Scheme and c.Host, which honor forwarding headers from trusted proxies.
+// GET and HEAD requests get 301, other methods 308 so the method and body
+// are kept.
+func RedirectWithConfig(config RedirectConfig) HandlerFunc {
+	return func(c *Context) {
+		if matchPath(config.ExemptPaths, c.Path()) {
+			c.Next()
+			return
+		}
+
+		scheme := c.Scheme()
+		host := c.Host()
+		hostname, port := splitHostPort(host)
+
+		targetScheme := scheme
+		if config.HTTPS {
+			targetScheme = "https"
+		}
+
+		if config.Host != "" {
+			hostname = config.Host
+			if h, p, err := net.SplitHostPort(config.Host); err == nil {
+				hostname, port = h, p
+			}
+		}
+
+		if targetScheme != scheme {
+			// The HTTP port means nothing to the HTTPS server
+			port = ""
+			if config.HTTPSPort != 0 && config.HTTPSPort != 443 {
+				port = strconv.Itoa(config.HTTPSPort)
+			}
+		}
+
+		targetHost := hostname
+		if port != "" {
+			targetHost = net.JoinHostPort(hostname, port)
+		} else if strings.Contains(hostname, ":") {
+			targetHost = "[" + hostname + "]"
+		}
+
+		if targetScheme == scheme && strings.EqualFold(targetHost, host) {
+			c.Next()
+			return
+		}
+
+		code := http.StatusMovedPermanently
+		if c.Method() != http.MethodGet && c.Method() != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		if config.Temporary {
+			code = http.StatusFound
+			if c.Method() != http.MethodGet && c.Method() != http.MethodHead {
+				code = http.StatusTemporaryRedirect
+			}
+		}
+
+		c.Redirect(code, targetScheme+"://"+targetHost+c.Request.URL.RequestURI())
+		c.Abort()
+	}
+}
+
+// splitHostPort splits an optional port off a host
+func splitHostPort(host string) (hostname, port string) {
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		return h, p
+	}
+	return strings.Trim(host, "[]"), ""
+}
@@ -0,0 +1,139 @@
+package aqylly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       RedirectConfig
+		method       string
+		url          string
+		wantStatus   int
+		wantLocation string
+	}{
+		{
+			name:         "https get",
+			config:       RedirectConfig{HTTPS: true},
+			method:       http.MethodGet,
+			url:          "http://example.com/a?q=1",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://example.com/a?q=1",
+		},
+		{
+			name:         "https post keeps the method",
+			config:       RedirectConfig{HTTPS: true},
+			method:       http.MethodPost,
+			url:          "http://example.com/a",
+			wantStatus:   http.StatusPermanentRedirect,
+			wantLocation: "https://example.com/a",
+		},
+		{
+			name:         "temporary get",
+			config:       RedirectConfig{HTTPS: true, Temporary: true},
+			method:       http.MethodGet,
+			url:          "http://example.com/a",
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://example.com/a",
+		},
+		{
+			name:         "temporary post",
+			config:       RedirectConfig{HTTPS: true, Temporary: true},
+			method:       http.MethodPost,
+			url:          "http://example.com/a",
+			wantStatus:   http.StatusTemporaryRedirect,
+			wantLocation: "https://example.com/a",
+		},
+		{
+			name:       "already https",
+			config:     RedirectConfig{HTTPS: true},
+			method:     http.MethodGet,
+			url:        "https://example.com/a",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "http port is dropped",
+			config:       RedirectConfig{HTTPS: true},
+			method:       http.MethodGet,
+			url:          "http://example.com:8080/a",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://example.com/a",
+		},
+		{
+			name:         "https port",
+			config:       RedirectConfig{HTTPS: true, HTTPSPort: 8443},
+			method:       http.MethodGet,
+			url:          "http://example.com:8080/a",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://example.com:8443/a",
+		},
+		{
+			name:         "ipv6 host",
+			config:       RedirectConfig{HTTPS: true},
+			method:       http.MethodGet,
+			url:          "http://[2001:db8::1]:8080/a",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://[2001:db8::1]/a",
+		},
+		{
+			name:         "ipv6 host with https port",
+			config:       RedirectConfig{HTTPS: true, HTTPSPort: 8443},
+			method:       http.MethodGet,
+			url:          "http://[2001:db8::1]/a",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://[2001:db8::1]:8443/a",
+		},
+		{
+			name:         "canonical host",
+			config:       RedirectConfig{Host: "www.example.com"},
+			method:       http.MethodGet,
+			url:          "https://example.com/a",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://www.example.com/a",
+		},
+		{
+			name:       "canonical host matches case-insensitively",
+			config:     RedirectConfig{Host: "www.example.com"},
+			method:     http.MethodGet,
+			url:        "https://WWW.Example.com/a",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "canonical host and https",
+			config:       RedirectConfig{HTTPS: true, Host: "www.example.com"},
+			method:       http.MethodGet,
+			url:          "http://example.com/a",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://www.example.com/a",
+		},
+		{
+			name:       "exempt path",
+			config:     RedirectConfig{HTTPS: true, ExemptPaths: []string{"/.well-known/acme-challenge/*"}},
+			method:     http.MethodGet,
+			url:        "http://example.com/.well-known/acme-challenge/token",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			r.Use(RedirectWithConfig(tt.config))
+			r.addRoute(tt.method, "/a", func(c *Context) { c.String(http.StatusOK, "ok") })
+			r.GET("/.well-known/acme-challenge/:token", func(c *Context) { c.String(http.StatusOK, "ok") })
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package aqylly
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// RequestIDKey is the key under which c.Get returns the request ID
+const RequestIDKey = "aqylly.request.id"
+
+// requestIDContextKey is the context key of the request ID
+type requestIDContextKey struct{}
+
+// RequestIDConfig holds the configuration for the RequestID middleware
+type RequestIDConfig struct {
+	// Header is the header carrying the request ID (default: "X-Request-ID")
+	Header string
+
+	// Generator creates new request IDs (default: NewUUIDv7)
+	Generator func() string
+
+	// MaxLength is the maximum length of an incoming ID (default: 128)
+	MaxLength int
+
+	// Validator checks incoming IDs; invalid IDs are replaced.
+	// By default only letters, digits and "-_.:+=/" are accepted.
+	Validator func(id string) bool
+}
+
+// RequestID returns a middleware that adds a unique request ID
+func RequestID() HandlerFunc {
+	return RequestIDWithConfig(RequestIDConfig{})
+}
+
+// RequestIDWithConfig returns a middleware that reuses a valid incoming
+// request ID or generates a new one. The ID is echoed in the response
+// header and available through c.RequestID().
+func RequestIDWithConfig(config RequestIDConfig) HandlerFunc {
+	if config.Header == "" {
+		config.Header = "X-Request-ID"
+	}
+	if config.Generator == nil {
+		config.Generator = NewUUIDv7
+	}
+	if config.MaxLength <= 0 {
+		config.MaxLength = 128
+	}
+	if config.Validator == nil {
+		config.Validator = validRequestID
+	}
+
+	return func(c *Context) {
+		requestID := c.Header(config.Header)
+		if requestID == "" || len(requestID) > config.MaxLength || !config.Validator(requestID) {
+			requestID = config.Generator()
+		}
+
+		c.SetHeader(config.Header, requestID)
+		c.WithContext(WithRequestID(c.Context(), requestID))
+		c.Set(RequestIDKey, requestID)
+		c.Next()
+	}
+}
+
+// RequestID returns the request ID set by the RequestID middleware
+func (c *Context) RequestID() string {
+	return RequestIDFromContext(c.ctx)
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// RequestIDTransport is an http.RoundTripper that propagates the request ID
+// of the outgoing request's context to downstream services
+type RequestIDTransport struct {
+	// Base is the underlying transport (default: http.DefaultTransport)
+	Base http.RoundTripper
+
+	// Header is the header carrying the request ID (default: "X-Request-ID")
+	Header string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	header := t.Header
+	if header == "" {
+		header = "X-Request-ID"
+	}
+
+	if requestID := RequestIDFromContext(req.Context()); requestID != "" && req.Header.Get(header) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(header, requestID)
+	}
+
+	return base.RoundTrip(req)
+}
+
+// NewUUIDv4 returns a random UUID (RFC 9562 version 4)
+func NewUUIDv4() string {
+	var b [16]byte
+	randomBytes(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b)
+}
+
+// NewUUIDv7 returns a time-ordered UUID (RFC 9562 version 7)
+func NewUUIDv7() string {
+	var b [16]byte
+	randomBytes(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b)
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a lexicographically sortable ULID
+func NewULID() string {
+	var b [16]byte
+	randomBytes(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	return encodeULID(b)
+}
+
+// encodeULID encodes 16 bytes as a ULID string
+func encodeULID(b [16]byte) string {
+	// 128 bits encoded as 26 characters of 5 bits, most significant first
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// formatUUID formats 16 bytes in the canonical UUID form
+func formatUUID(b [16]byte) string {
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf)
+}
+
+// randomBytes fills b from crypto/rand
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
+
+// validRequestID reports whether the ID only contains safe characters
+func validRequestID(id string) bool {
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '+', c == '=', c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,210 @@
+package aqylly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	ulidPattern = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+)
+
+func TestFormatUUID(t *testing.T) {
+	// Example from RFC 9562, appendix A.6
+	b := [16]byte{0x01, 0x7f, 0x22, 0xe2, 0x79, 0xb0, 0x7c, 0xc3, 0x98, 0xc4, 0xdc, 0x0c, 0x0c, 0x07, 0x39, 0x8f}
+	if got, want := formatUUID(b), "017f22e2-79b0-7cc3-98c4-dc0c0c07398f"; got != want {
+		t.Errorf("formatUUID = %s, want %s", got, want)
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	tests := []struct {
+		name    string
+		new     func() string
+		version byte
+	}{
+		{"v4", NewUUIDv4, '4'},
+		{"v7", NewUUIDv7, '7'},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[string]bool)
+			for i := 0; i < 100; i++ {
+				id := tt.new()
+				if !uuidPattern.MatchString(id) {
+					t.Fatalf("%s is not a canonical UUID", id)
+				}
+				if id[14] != tt.version {
+					t.Fatalf("%s: version = %c, want %c", id, id[14], tt.version)
+				}
+				if !strings.ContainsRune("89ab", rune(id[19])) {
+					t.Fatalf("%s: variant = %c, want one of 89ab", id, id[19])
+				}
+				if seen[id] {
+					t.Fatalf("duplicate ID %s", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+}
+
+func TestNewUUIDv7Timestamp(t *testing.T) {
+	before := time.Now().UnixMilli()
+	id := NewUUIDv7()
+	after := time.Now().UnixMilli()
+
+	ms, err := strconv.ParseInt(strings.ReplaceAll(id[:13], "-", ""), 16, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms < before || ms > after {
+		t.Errorf("timestamp = %d, want between %d and %d", ms, before, after)
+	}
+}
+
+func TestEncodeULID(t *testing.T) {
+	tests := []struct {
+		name string
+		b    [16]byte
+		want string
+	}{
+		{"zero", [16]byte{}, "00000000000000000000000000"},
+		{"max", [16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+		{"last bit", [16]byte{15: 0x01}, "00000000000000000000000001"},
+		// Timestamp of the example in the ULID specification
+		{"timestamp", [16]byte{0x01, 0x56, 0x3e, 0x3a, 0xb5, 0xd3}, "01ARZ3NDEK0000000000000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeULID(tt.b); got != tt.want {
+				t.Errorf("encodeULID = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	prev := ""
+	for i := 0; i < 100; i++ {
+		id := NewULID()
+		if !ulidPattern.MatchString(id) {
+			t.Fatalf("%s is not a ULID", id)
+		}
+		// The timestamp prefix never decreases
+		if id[:10] < prev {
+			t.Fatalf("timestamp %s sorts before %s", id[:10], prev)
+		}
+		prev = id[:10]
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"017f22e2-79b0-7cc3-98c4-dc0c0c07398f", true},
+		{"01ARZ3NDEKTSV4RRFFQ69G5FAV", true},
+		{"trace:abc/def+1=_.", true},
+		{"with space", false},
+		{"line\nbreak", false},
+		{"quote\"", false},
+		{"ünicode", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := validRequestID(tt.id); got != tt.want {
+				t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	r := New()
+	r.Use(RequestIDWithConfig(RequestIDConfig{MaxLength: 40}))
+	r.GET("/", func(c *Context) {
+		fromGet, _ := c.Get(RequestIDKey)
+		if fromGet != c.RequestID() {
+			t.Errorf("c.Get = %v, want %s", fromGet, c.RequestID())
+		}
+		c.String(http.StatusOK, "%s", RequestIDFromContext(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		reused   bool
+	}{
+		{"generated", "", false},
+		{"reused", "abc-123", true},
+		{"invalid", "abc 123", false},
+		{"too long", strings.Repeat("a", 41), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set("X-Request-ID", tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get("X-Request-ID")
+			if w.Body.String() != id {
+				t.Errorf("context request ID = %q, want %q", w.Body.String(), id)
+			}
+			if tt.reused {
+				if id != tt.incoming {
+					t.Errorf("request ID = %q, want %q", id, tt.incoming)
+				}
+			} else if !uuidPattern.MatchString(id) {
+				t.Errorf("request ID = %q, want a generated UUID", id)
+			}
+		})
+	}
+}
+
+func TestRequestIDContextKey(t *testing.T) {
+	ctx := context.WithValue(context.Background(), RequestIDKey, "plain")
+	if got := RequestIDFromContext(ctx); got != "" {
+		t.Errorf("RequestIDFromContext = %q, want the string key to be ignored", got)
+	}
+	if got := RequestIDFromContext(WithRequestID(ctx, "abc")); got != "abc" {
+		t.Errorf("RequestIDFromContext = %q, want abc", got)
+	}
+}
+
+func TestRequestIDTransport(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("X-Request-ID"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &RequestIDTransport{}}
+	for _, ctx := range []context.Context{context.Background(), WithRequestID(context.Background(), "abc")} {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if len(got) != 2 || got[0] != "" || got[1] != "abc" {
+		t.Errorf("X-Request-ID = %q, want [\"\" \"abc\"]", got)
+	}
+}
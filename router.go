@@ -2,14 +2,20 @@ package aqylly
 
 import (
 	"context"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Router is the main router instance
 type Router struct {
 	trees      map[string]*node
 	middleware []HandlerFunc
+	pre        []HandlerFunc
 	pool       sync.Pool
 
 	// HTTP/2 configuration
@@ -28,8 +34,63 @@ type Router struct {
 	// Handle OPTIONS requests automatically
 	HandleOPTIONS bool
 
+	// TrustedProxies lists the networks whose forwarding headers are honored
+	// by ClientIP, Scheme and Host. Use SetTrustedProxies to parse strings.
+	TrustedProxies []netip.Prefix
+
+	// ProxyHeader selects the forwarding headers honored from trusted proxies
+	// (default: ProxyHeaderXForwarded). Only the selected kind is read, so a
+	// client cannot slip the other kind past a proxy that does not strip it.
+	ProxyHeader ProxyHeader
+
+	// ClientIPHeader is a header set by a trusted proxy that carries the
+	// client IP, such as "CF-Connecting-IP" or "X-Real-IP". When set, it is
+	// the only header ClientIP reads.
+	ClientIPHeader string
+
+	// Logger is the base logger returned by Context.Logger (default: slog.Default())
+	Logger *slog.Logger
+
 	// Internal HTTP server for graceful shutdown
 	server *http.Server
+
+	// Metrics recorded by the Metrics middleware
+	metrics *metrics
+
+	// Registered routes in registration order
+	routes []*Route
+
+	// Circuit breakers that guard a route, keyed by *Route
+	breakers sync.Map
+
+	// ShutdownDelay is how long readiness reports failing before Shutdown
+	// stops accepting connections, so load balancers can drain the instance
+	ShutdownDelay time.Duration
+
+	// Set once Shutdown has begun
+	shuttingDown atomic.Bool
+
+	// Maintenance mode configuration, nil when disabled
+	maintenance atomic.Pointer[MaintenanceConfig]
+}
+
+// Route describes a registered route
+type Route struct {
+	// Method is the HTTP method
+	Method string `json:"method"`
+
+	// Path is the route pattern, such as /users/:id
+	Path string `json:"path"`
+
+	// Name is an optional name for the route
+	Name string `json:"name,omitempty"`
+
+	// CircuitState is the state of the circuit breaker guarding the route,
+	// reported by Routes once the breaker has handled a request
+	CircuitState string `json:"circuit_state,omitempty"`
+
+	// group is the group that registered the route, if any
+	group *RouterGroup
 }
 
 // New creates a new router instance
@@ -40,10 +101,11 @@ func New() *Router {
 		EnableHTTP2:   true,  // HTTP/2 enabled by default
 		EnableHTTP3:   false, // HTTP/3 disabled by default
 		HandleOPTIONS: true,
+		metrics:       newMetrics(),
 	}
 
 	r.pool.New = func() interface{} {
-		return newContext(nil, nil)
+		return &Context{router: r}
 	}
 
 	return r
@@ -61,8 +123,15 @@ func (r *Router) Use(middleware ...HandlerFunc) {
 	r.middleware = append(r.middleware, middleware...)
 }
 
+// Pre adds middleware that runs before the route is looked up, for every
+// request. It may change the request method or path; c.Route() and
+// c.Params are not set yet.
+func (r *Router) Pre(middleware ...HandlerFunc) {
+	r.pre = append(r.pre, middleware...)
+}
+
 // addRoute adds a route to the router
-func (r *Router) addRoute(method, path string, handler HandlerFunc) {
+func (r *Router) addRoute(method, path string, handler HandlerFunc) *Route {
 	if path[0] != '/' {
 		panic("path must begin with '/'")
 	}
@@ -73,42 +142,65 @@ func (r *Router) addRoute(method, path string, handler HandlerFunc) {
 		r.trees[method] = root
 	}
 
-	root.addRoute(path, method, handler)
+	route := &Route{Method: method, Path: path}
+	root.addRoute(path, method, handler, route)
+	r.routes = append(r.routes, route)
+	return route
+}
+
+// Routes returns the registered routes sorted by path and method
+func (r *Router) Routes() []Route {
+	routes := make([]Route, 0, len(r.routes))
+	for _, route := range r.routes {
+		info := *route
+		if cb, ok := r.breakers.Load(route); ok {
+			info.CircuitState = cb.(*circuitBreaker).currentState().String()
+		}
+		routes = append(routes, info)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
 }
 
 // GET registers a GET route
-func (r *Router) GET(path string, handler HandlerFunc) {
-	r.addRoute(http.MethodGet, path, handler)
+func (r *Router) GET(path string, handler HandlerFunc) *Route {
+	return r.addRoute(http.MethodGet, path, handler)
 }
 
 // POST registers a POST route
-func (r *Router) POST(path string, handler HandlerFunc) {
-	r.addRoute(http.MethodPost, path, handler)
+func (r *Router) POST(path string, handler HandlerFunc) *Route {
+	return r.addRoute(http.MethodPost, path, handler)
 }
 
 // PUT registers a PUT route
-func (r *Router) PUT(path string, handler HandlerFunc) {
-	r.addRoute(http.MethodPut, path, handler)
+func (r *Router) PUT(path string, handler HandlerFunc) *Route {
+	return r.addRoute(http.MethodPut, path, handler)
 }
 
 // DELETE registers a DELETE route
-func (r *Router) DELETE(path string, handler HandlerFunc) {
-	r.addRoute(http.MethodDelete, path, handler)
+func (r *Router) DELETE(path string, handler HandlerFunc) *Route {
+	return r.addRoute(http.MethodDelete, path, handler)
 }
 
 // PATCH registers a PATCH route
-func (r *Router) PATCH(path string, handler HandlerFunc) {
-	r.addRoute(http.MethodPatch, path, handler)
+func (r *Router) PATCH(path string, handler HandlerFunc) *Route {
+	return r.addRoute(http.MethodPatch, path, handler)
 }
 
 // HEAD registers a HEAD route
-func (r *Router) HEAD(path string, handler HandlerFunc) {
-	r.addRoute(http.MethodHead, path, handler)
+func (r *Router) HEAD(path string, handler HandlerFunc) *Route {
+	return r.addRoute(http.MethodHead, path, handler)
 }
 
 // OPTIONS registers an OPTIONS route
-func (r *Router) OPTIONS(path string, handler HandlerFunc) {
-	r.addRoute(http.MethodOptions, path, handler)
+func (r *Router) OPTIONS(path string, handler HandlerFunc) *Route {
+	return r.addRoute(http.MethodOptions, path, handler)
 }
 
 // Any registers a route for all HTTP methods
@@ -142,40 +234,55 @@ func (r *Router) Group(prefix string, middleware ...HandlerFunc) *RouterGroup {
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// Get context from pool
 	c := r.pool.Get().(*Context)
-	c.Writer = w
-	c.Request = req
-	c.ctx = req.Context()
-	c.Params = make(map[string]string)
+	c.reset(w, req)
+
+	if len(r.pre) > 0 {
+		// Pre-routing middleware runs first and may rewrite the request
+		c.handlers = make([]HandlerFunc, 0, len(r.pre)+1)
+		c.handlers = append(c.handlers, r.pre...)
+		c.handlers = append(c.handlers, r.handleRequest)
+		c.Next()
+	} else {
+		r.handleRequest(c)
+	}
+
+	// Put context back to pool
+	r.pool.Put(c)
+}
+
+// handleRequest finds the handler for the request and runs it with the global middleware
+func (r *Router) handleRequest(c *Context) {
+	// Replace the pre-routing chain, if any
+	c.handlers = nil
 	c.index = -1
-	c.queryCache = nil
-	c.statusCode = http.StatusOK
 
 	// Find handler
-	method := req.Method
-	path := req.URL.Path
-
-	if root := r.trees[method]; root != nil {
-		if handler, params := root.getValue(path, method); handler != nil {
-			c.Params = params
+	method := c.Request.Method
+	path := c.Request.URL.Path
 
-			// Build handlers chain (middleware + handler)
-			c.handlers = make([]HandlerFunc, 0, len(r.middleware)+1)
-			c.handlers = append(c.handlers, r.middleware...)
-			c.handlers = append(c.handlers, handler)
+	// Answer with 503 during maintenance, after the global middleware
+	if m := r.maintenance.Load(); m != nil && !maintenanceAllows(c, m) {
+		r.serve(c, maintenanceHandler(m))
+		return
+	}
 
-			// Execute chain
-			c.Next()
+	if method == http.MethodOptions {
+		c.allowed = r.allowedMethods(path)
+	}
 
-			// Put context back to pool
-			r.pool.Put(c)
+	if root := r.trees[method]; root != nil {
+		if handler, params, route := root.getValue(path, method); handler != nil {
+			c.Params = params
+			c.route = route
+			r.serve(c, handler)
 			return
 		}
 	}
 
 	// Handle OPTIONS automatically if enabled
-	if method == http.MethodOptions && r.HandleOPTIONS {
-		r.handleOPTIONS(c, path)
-		r.pool.Put(c)
+	if method == http.MethodOptions && r.HandleOPTIONS && len(c.allowed) > 0 {
+		// Global and group middleware run so that CORS can answer preflight requests
+		r.serve(c, r.optionsHandler(c, path))
 		return
 	}
 
@@ -183,15 +290,13 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	for m := range r.trees {
 		if m != method {
 			if root := r.trees[m]; root != nil {
-				if handler, _ := root.getValue(path, m); handler != nil {
+				if handler, _, _ := root.getValue(path, m); handler != nil {
 					// Method not allowed
 					if r.MethodNotAllowed != nil {
-						c.handlers = []HandlerFunc{r.MethodNotAllowed}
-						c.Next()
+						r.serve(c, r.MethodNotAllowed)
 					} else {
-						http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+						r.serve(c, methodNotAllowed)
 					}
-					r.pool.Put(c)
 					return
 				}
 			}
@@ -200,33 +305,62 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	// Not found
 	if r.NotFound != nil {
-		c.handlers = []HandlerFunc{r.NotFound}
-		c.Next()
+		r.serve(c, r.NotFound)
 	} else {
-		http.NotFound(w, req)
+		r.serve(c, notFound)
 	}
+}
 
-	r.pool.Put(c)
+// serve runs the global middleware followed by the handler
+func (r *Router) serve(c *Context, handler HandlerFunc) {
+	c.handlers = make([]HandlerFunc, 0, len(r.middleware)+1)
+	c.handlers = append(c.handlers, r.middleware...)
+	c.handlers = append(c.handlers, handler)
+	c.Next()
 }
 
-// handleOPTIONS handles OPTIONS requests automatically
-func (r *Router) handleOPTIONS(c *Context, path string) {
+// notFound is the default 404 handler
+func notFound(c *Context) {
+	http.NotFound(c.Writer, c.Request)
+}
+
+// methodNotAllowed is the default 405 handler
+func methodNotAllowed(c *Context) {
+	http.Error(c.Writer, "Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+// allowedMethods returns the sorted methods registered for the path
+func (r *Router) allowedMethods(path string) []string {
 	allowed := make([]string, 0, 7)
 
 	for method := range r.trees {
 		if root := r.trees[method]; root != nil {
-			if handler, _ := root.getValue(path, method); handler != nil {
+			if handler, _, _ := root.getValue(path, method); handler != nil {
 				allowed = append(allowed, method)
 			}
 		}
 	}
 
-	if len(allowed) > 0 {
-		c.SetHeader("Allow", joinMethods(allowed))
-		c.Status(http.StatusNoContent)
-	} else {
-		c.Status(http.StatusNotFound)
+	sort.Strings(allowed)
+	return allowed
+}
+
+// optionsHandler returns the automatic OPTIONS handler for the path, wrapped
+// in the middleware of the first group that registered a route for it
+func (r *Router) optionsHandler(c *Context, path string) HandlerFunc {
+	for _, method := range c.allowed {
+		if _, params, route := r.trees[method].getValue(path, method); route != nil && route.group != nil {
+			c.Params = params
+			return route.group.wrap(handleOPTIONS)
+		}
 	}
+	return handleOPTIONS
+}
+
+// handleOPTIONS handles OPTIONS requests automatically
+func handleOPTIONS(c *Context) {
+	c.SetHeader("Allow", joinMethods(c.allowed))
+	c.Status(http.StatusNoContent)
 }
 
 // Run starts the HTTP server
@@ -270,11 +404,24 @@ func (r *Router) RunH2C(addr string) error {
 	return r.server.ListenAndServe()
 }
 
-// Shutdown gracefully shuts down the server
+// Shutdown gracefully shuts down the server. Readiness checks registered
+// with Health fail from the moment it is called; the server keeps serving
+// for ShutdownDelay before it stops accepting connections.
 func (r *Router) Shutdown(ctx context.Context) error {
+	r.shuttingDown.Store(true)
 	if r.server == nil {
 		return nil
 	}
+
+	if r.ShutdownDelay > 0 {
+		timer := time.NewTimer(r.ShutdownDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
 	return r.server.Shutdown(ctx)
 }
 
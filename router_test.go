@@ -0,0 +1,145 @@
+package aqylly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGlobalMiddlewareUnmatched(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		custom bool
+		want   int
+	}{
+		{"matched", http.MethodGet, "/users/1", false, http.StatusOK},
+		{"not found", http.MethodGet, "/missing", false, http.StatusNotFound},
+		{"method not allowed", http.MethodDelete, "/users/1", false, http.StatusMethodNotAllowed},
+		{"custom not found", http.MethodGet, "/missing", true, http.StatusNotFound},
+		{"custom method not allowed", http.MethodDelete, "/users/1", true, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			ran := false
+			r.Use(func(c *Context) {
+				ran = true
+				c.SetHeader("X-Middleware", "global")
+				c.Next()
+			})
+			r.GET("/users/:id", func(c *Context) {
+				c.String(http.StatusOK, "%s", c.Param("id"))
+			})
+			if tt.custom {
+				r.NotFound = func(c *Context) {
+					c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+				}
+				r.MethodNotAllowed = func(c *Context) {
+					c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+				}
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if !ran || w.Header().Get("X-Middleware") != "global" {
+				t.Error("global middleware did not run")
+			}
+		})
+	}
+}
+
+func TestMetricsUnmatched(t *testing.T) {
+	r := New()
+	r.Use(Metrics())
+	r.GET("/users/:id", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.Param("id"))
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/users/1", nil),
+		httptest.NewRequest(http.MethodGet, "/missing", nil),
+		httptest.NewRequest(http.MethodPost, "/users/1", nil),
+		httptest.NewRequest("AAA", "/users/1", nil),
+		httptest.NewRequest("BBB", "/users/1", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	output := string(r.metrics.render())
+	for _, want := range []string{
+		`method="GET",route="/users/:id",status="200"`,
+		`method="GET",route="unmatched",status="404"`,
+		`method="POST",route="unmatched",status="405"`,
+		`method="other",route="unmatched",status="405"`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+	for _, method := range []string{"AAA", "BBB"} {
+		if strings.Contains(output, `method="`+method+`"`) {
+			t.Errorf("metrics contain a series for method %s", method)
+		}
+	}
+}
+
+func TestPreMiddleware(t *testing.T) {
+	var calls []string
+	r := New()
+	r.Pre(func(c *Context) {
+		calls = append(calls, "pre")
+		if c.Header("X-Block") != "" {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Request.URL.Path = strings.TrimSuffix(c.Request.URL.Path, "/")
+		c.Next()
+		calls = append(calls, "pre-after")
+	})
+	r.Use(func(c *Context) {
+		calls = append(calls, "global")
+		c.Next()
+	})
+	r.GET("/users/:id", func(c *Context) {
+		calls = append(calls, "handler")
+		c.String(http.StatusOK, "%s", c.Param("id"))
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		block      bool
+		wantStatus int
+		wantCalls  string
+	}{
+		{"rewritten before routing", "/users/1/", false, http.StatusOK, "pre,global,handler,pre-after"},
+		{"abort skips routing", "/users/1", true, http.StatusForbidden, "pre"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.block {
+				req.Header.Set("X-Block", "1")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := strings.Join(calls, ","); got != tt.wantCalls {
+				t.Errorf("calls = %s, want %s", got, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package aqylly
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSPNonceKey is the context key under which the CSP nonce is stored
+const CSPNonceKey = "aqylly.csp.nonce"
+
+// SecureConfig holds the configuration for the Secure middleware.
+// Empty fields are not sent, so a group can override only some headers.
+type SecureConfig struct {
+	// ContentSecurityPolicy is the CSP header value. Every "{nonce}"
+	// is replaced with a per-request nonce available through c.CSPNonce().
+	ContentSecurityPolicy string
+
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only
+	CSPReportOnly bool
+
+	// HSTSMaxAge enables Strict-Transport-Security on TLS requests
+	HSTSMaxAge time.Duration
+
+	// HSTSIncludeSubdomains adds includeSubDomains to HSTS
+	HSTSIncludeSubdomains bool
+
+	// HSTSPreload adds preload to HSTS
+	HSTSPreload bool
+
+	// ContentTypeOptions is the X-Content-Type-Options value (e.g. "nosniff")
+	ContentTypeOptions string
+
+	// FrameOptions is the X-Frame-Options value (e.g. "DENY", "SAMEORIGIN")
+	FrameOptions string
+
+	// ReferrerPolicy is the Referrer-Policy value
+	ReferrerPolicy string
+
+	// PermissionsPolicy is the Permissions-Policy value
+	PermissionsPolicy string
+
+	// CrossOriginOpenerPolicy is the Cross-Origin-Opener-Policy value
+	CrossOriginOpenerPolicy string
+
+	// CrossOriginEmbedderPolicy is the Cross-Origin-Embedder-Policy value
+	CrossOriginEmbedderPolicy string
+
+	// CrossOriginResourcePolicy is the Cross-Origin-Resource-Policy value
+	CrossOriginResourcePolicy string
+}
+
+// DefaultSecureConfig returns the configuration used by Secure
+func DefaultSecureConfig() SecureConfig {
+	return SecureConfig{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentTypeOptions:    "nosniff",
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+	}
+}
+
+// Secure returns a middleware that adds security headers
+func Secure() HandlerFunc {
+	return SecureWithConfig(DefaultSecureConfig())
+}
+
+// SecureWithConfig returns a middleware that adds the configured security headers.
+// HSTS is only sent on TLS requests.
+func SecureWithConfig(config SecureConfig) HandlerFunc {
+	hsts := ""
+	if config.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(config.HSTSMaxAge/time.Second), 10)
+		if config.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if config.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if config.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	useNonce := strings.Contains(config.ContentSecurityPolicy, "{nonce}")
+
+	headers := [][2]string{
+		{"X-Content-Type-Options", config.ContentTypeOptions},
+		{"X-Frame-Options", config.FrameOptions},
+		{"Referrer-Policy", config.ReferrerPolicy},
+		{"Permissions-Policy", config.PermissionsPolicy},
+		{"Cross-Origin-Opener-Policy", config.CrossOriginOpenerPolicy},
+		{"Cross-Origin-Embedder-Policy", config.CrossOriginEmbedderPolicy},
+		{"Cross-Origin-Resource-Policy", config.CrossOriginResourcePolicy},
+	}
+
+	return func(c *Context) {
+		for _, h := range headers {
+			if h[1] != "" {
+				c.SetHeader(h[0], h[1])
+			}
+		}
+
+		if hsts != "" && c.Scheme() == "https" {
+			c.SetHeader("Strict-Transport-Security", hsts)
+		}
+
+		if config.ContentSecurityPolicy != "" {
+			csp := config.ContentSecurityPolicy
+			if useNonce {
+				nonce := c.CSPNonce()
+				if nonce == "" {
+					nonce = generateNonce()
+					c.Set(CSPNonceKey, nonce)
+				}
+				csp = strings.ReplaceAll(csp, "{nonce}", nonce)
+			}
+			c.SetHeader(cspHeader, csp)
+		}
+
+		c.Next()
+	}
+}
+
+// CSPNonce returns the Content-Security-Policy nonce of the request
+func (c *Context) CSPNonce() string {
+	if v, ok := c.Get(CSPNonceKey); ok {
+		if nonce, ok := v.(string); ok {
+			return nonce
+		}
+	}
+	return ""
+}
+
+// generateNonce returns a random base64 nonce
+func generateNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
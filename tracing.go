@@ -0,0 +1,351 @@
+package aqylly
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// spanKey is the context key of the active span
+type spanKey struct{}
+
+// remoteSpanKey is the context key of a span context extracted from headers
+type remoteSpanKey struct{}
+
+// SpanContext identifies a span within a trace (W3C Trace Context)
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+	Remote     bool
+}
+
+// IsValid reports whether the trace and span IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// IsSampled reports whether the sampled flag is set
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&0x01 != 0
+}
+
+// TraceIDString returns the trace ID in hex
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// SpanIDString returns the span ID in hex
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+// Traceparent returns the traceparent header value
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceIDString(), sc.SpanIDString(), sc.Flags)
+}
+
+// Span is a unit of work within a trace
+type Span interface {
+	// SpanContext returns the identity of the span
+	SpanContext() SpanContext
+
+	// SetName renames the span
+	SetName(name string)
+
+	// SetAttribute records an attribute
+	SetAttribute(key string, value interface{})
+
+	// SetStatus records the HTTP status code
+	SetStatus(code int)
+
+	// RecordError records an error
+	RecordError(err error)
+
+	// End finishes the span
+	End()
+}
+
+// Tracer starts spans. Implement it to bridge to a tracing backend.
+type Tracer interface {
+	// Start starts a span whose parent is the span or remote span context in ctx
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// SpanFromContext returns the active span in ctx
+func SpanFromContext(ctx context.Context) Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// ContextWithSpan returns a copy of ctx carrying the span
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx carrying a span context received from a peer
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return context.WithValue(ctx, remoteSpanKey{}, sc)
+}
+
+// parentSpanContext returns the span context new spans should use as parent
+func parentSpanContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext(), true
+	}
+	sc, ok := ctx.Value(remoteSpanKey{}).(SpanContext)
+	return sc, ok
+}
+
+// newSpanContext creates a child of parent, or a new sampled root
+func newSpanContext(parent SpanContext, hasParent bool) SpanContext {
+	var sc SpanContext
+	if hasParent && parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		randomBytes(sc.TraceID[:])
+		sc.Flags = 0x01
+	}
+	randomBytes(sc.SpanID[:])
+	return sc
+}
+
+// NoopTracer creates spans that propagate trace context but record nothing
+type NoopTracer struct{}
+
+// Start implements Tracer
+func (NoopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, ok := parentSpanContext(ctx)
+	span := &noopSpan{sc: newSpanContext(parent, ok)}
+	return ContextWithSpan(ctx, span), span
+}
+
+// noopSpan is a span that records nothing
+type noopSpan struct {
+	sc SpanContext
+}
+
+func (s *noopSpan) SpanContext() SpanContext                   { return s.sc }
+func (s *noopSpan) SetName(name string)                        {}
+func (s *noopSpan) SetAttribute(key string, value interface{}) {}
+func (s *noopSpan) SetStatus(code int)                         {}
+func (s *noopSpan) RecordError(err error)                      {}
+func (s *noopSpan) End()                                       {}
+
+// RecordedSpan is a finished span kept by RecordingTracer
+type RecordedSpan struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Attributes  map[string]interface{}
+	Status      int
+	Errors      []error
+	Start       time.Time
+	End         time.Time
+}
+
+// RecordingTracer keeps finished spans in memory, which is useful in tests
+type RecordingTracer struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+// NewRecordingTracer creates an empty recording tracer
+func NewRecordingTracer() *RecordingTracer {
+	return &RecordingTracer{}
+}
+
+// Start implements Tracer
+func (t *RecordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, ok := parentSpanContext(ctx)
+	span := &recordingSpan{
+		tracer: t,
+		data: RecordedSpan{
+			Name:        name,
+			SpanContext: newSpanContext(parent, ok),
+			Parent:      parent,
+			Attributes:  make(map[string]interface{}),
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// Spans returns the finished spans
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]RecordedSpan(nil), t.spans...)
+}
+
+// Reset removes all finished spans
+func (t *RecordingTracer) Reset() {
+	t.mu.Lock()
+	t.spans = nil
+	t.mu.Unlock()
+}
+
+// recordingSpan is a span recorded by RecordingTracer
+type recordingSpan struct {
+	mu     sync.Mutex
+	tracer *RecordingTracer
+	data   RecordedSpan
+	ended  bool
+}
+
+func (s *recordingSpan) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *recordingSpan) SetName(name string) {
+	s.mu.Lock()
+	s.data.Name = name
+	s.mu.Unlock()
+}
+
+func (s *recordingSpan) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	s.data.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+func (s *recordingSpan) SetStatus(code int) {
+	s.mu.Lock()
+	s.data.Status = code
+	s.mu.Unlock()
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.mu.Lock()
+	s.data.Errors = append(s.data.Errors, err)
+	s.mu.Unlock()
+}
+
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	s.tracer.spans = append(s.tracer.spans, data)
+	s.tracer.mu.Unlock()
+}
+
+// Tracing returns a middleware that continues the trace from the traceparent
+// and tracestate headers, or starts a new one, and runs the request in a span
+// named after the route pattern. A nil tracer uses NoopTracer.
+func Tracing(tracer Tracer) HandlerFunc {
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+
+	return func(c *Context) {
+		ctx := c.Context()
+		if sc, ok := extractSpanContext(c.Request.Header); ok {
+			ctx = ContextWithRemoteSpanContext(ctx, sc)
+		}
+
+		name := c.Method()
+		if c.Route() != "" {
+			name += " " + c.Route()
+		}
+
+		ctx, span := tracer.Start(ctx, name)
+		c.WithContext(ctx)
+
+		span.SetAttribute("http.request.method", c.Method())
+		span.SetAttribute("http.route", c.Route())
+		span.SetAttribute("url.path", c.Path())
+		span.SetAttribute("client.address", c.ClientIP())
+
+		defer func() {
+			if err := recover(); err != nil {
+				span.RecordError(fmt.Errorf("panic: %v", err))
+				span.SetStatus(http.StatusInternalServerError)
+				span.End()
+				panic(err)
+			}
+
+			span.SetAttribute("http.response.status_code", c.writer.status)
+			span.SetStatus(c.writer.status)
+			span.End()
+		}()
+
+		c.Next()
+	}
+}
+
+// Span returns the active span of the request
+func (c *Context) Span() Span {
+	return SpanFromContext(c.ctx)
+}
+
+// extractSpanContext parses the traceparent and tracestate headers
+func extractSpanContext(header http.Header) (SpanContext, bool) {
+	value := strings.TrimSpace(header.Get("traceparent"))
+	traceID, spanID, ok := parseTraceparent(value)
+	if !ok {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	hex.Decode(sc.TraceID[:], []byte(traceID))
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+	flags, _ := hex.DecodeString(value[53:55])
+	sc.Flags = flags[0]
+
+	if state := strings.Join(header.Values("tracestate"), ","); len(state) <= 512 {
+		sc.TraceState = state
+	}
+
+	return sc, true
+}
+
+// injectSpanContext writes the traceparent and tracestate headers
+func injectSpanContext(header http.Header, sc SpanContext) {
+	header.Set("traceparent", sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set("tracestate", sc.TraceState)
+	} else {
+		header.Del("tracestate")
+	}
+}
+
+// TracingTransport is an http.RoundTripper that propagates the trace context
+// of the outgoing request's context to downstream services
+type TracingTransport struct {
+	// Base is the underlying transport (default: http.DefaultTransport)
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if sc, ok := parentSpanContext(req.Context()); ok && sc.IsValid() {
+		req = req.Clone(req.Context())
+		injectSpanContext(req.Header, sc)
+	}
+
+	return base.RoundTrip(req)
+}
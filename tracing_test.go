@@ -0,0 +1,193 @@
+package aqylly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// W3C Trace Context example values
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID      = "00f067aa0ba902b7"
+	testTraceparent = "00-" + testTraceID + "-" + testSpanID + "-01"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"valid", testTraceparent, true},
+		{"not sampled", "00-" + testTraceID + "-" + testSpanID + "-00", true},
+		{"future version with suffix", "01-" + testTraceID + "-" + testSpanID + "-01-extra", true},
+		{"version 00 with suffix", testTraceparent + "-extra", false},
+		{"version ff", "ff-" + testTraceID + "-" + testSpanID + "-01", false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + testSpanID + "-01", false},
+		{"zero trace id", "00-00000000000000000000000000000000-" + testSpanID + "-01", false},
+		{"zero span id", "00-" + testTraceID + "-0000000000000000-01", false},
+		{"bad separator", "00_" + testTraceID + "-" + testSpanID + "-01", false},
+		{"short", "00-" + testTraceID + "-" + testSpanID, false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traceID, spanID, ok := parseTraceparent(tt.value)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && (traceID != testTraceID || spanID != testSpanID) {
+				t.Errorf("ids = %s %s, want %s %s", traceID, spanID, testTraceID, testSpanID)
+			}
+		})
+	}
+}
+
+func TestExtractSpanContext(t *testing.T) {
+	header := http.Header{}
+	header.Set("traceparent", testTraceparent)
+	header.Add("tracestate", "rojo=00f067aa0ba902b7")
+	header.Add("tracestate", "congo=t61rcWkgMzE")
+
+	sc, ok := extractSpanContext(header)
+	if !ok {
+		t.Fatal("expected a span context")
+	}
+	if sc.TraceIDString() != testTraceID || sc.SpanIDString() != testSpanID {
+		t.Errorf("ids = %s %s, want %s %s", sc.TraceIDString(), sc.SpanIDString(), testTraceID, testSpanID)
+	}
+	if !sc.IsSampled() {
+		t.Error("expected the sampled flag")
+	}
+	if sc.Traceparent() != testTraceparent {
+		t.Errorf("Traceparent = %s, want %s", sc.Traceparent(), testTraceparent)
+	}
+	if want := "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"; sc.TraceState != want {
+		t.Errorf("TraceState = %q, want %q", sc.TraceState, want)
+	}
+
+	header.Set("traceparent", "00-"+testTraceID+"-"+testSpanID)
+	if _, ok := extractSpanContext(header); ok {
+		t.Error("expected an invalid traceparent to be ignored")
+	}
+}
+
+func TestTracing(t *testing.T) {
+	tracer := NewRecordingTracer()
+	r := New()
+	r.Use(Tracing(tracer))
+	r.GET("/users/:id", func(c *Context) {
+		if c.Span() == nil {
+			t.Error("expected an active span")
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	tests := []struct {
+		name        string
+		traceparent string
+		wantParent  bool
+	}{
+		{"new trace", "", false},
+		{"continued trace", testTraceparent, true},
+		{"invalid traceparent", "00-xyz", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := tracer.Spans()
+			if len(spans) != 1 {
+				t.Fatalf("spans = %d, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name != "GET /users/:id" {
+				t.Errorf("name = %q, want %q", span.Name, "GET /users/:id")
+			}
+			if span.Status != http.StatusOK {
+				t.Errorf("status = %d, want %d", span.Status, http.StatusOK)
+			}
+			if !span.SpanContext.IsValid() {
+				t.Error("expected a valid span context")
+			}
+
+			continued := span.SpanContext.TraceIDString() == testTraceID
+			if continued != tt.wantParent {
+				t.Errorf("trace continued = %v, want %v", continued, tt.wantParent)
+			}
+			if tt.wantParent && (span.Parent.SpanIDString() != testSpanID || !span.Parent.Remote) {
+				t.Errorf("parent = %+v, want the remote span %s", span.Parent, testSpanID)
+			}
+		})
+	}
+}
+
+func TestSpanContextKeys(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "aqylly.trace.span", &noopSpan{})
+	if SpanFromContext(ctx) != nil {
+		t.Error("expected the string key to be ignored")
+	}
+
+	span := &noopSpan{}
+	if SpanFromContext(ContextWithSpan(ctx, span)) != span {
+		t.Error("expected the span stored with ContextWithSpan")
+	}
+}
+
+func TestTracingTransport(t *testing.T) {
+	var traceparent, tracestate string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		tracestate = r.Header.Get("tracestate")
+	}))
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("traceparent", testTraceparent)
+	header.Set("tracestate", "rojo=00f067aa0ba902b7")
+	remote, _ := extractSpanContext(header)
+	ctx, span := NoopTracer{}.Start(ContextWithRemoteSpanContext(context.Background(), remote), "client")
+
+	tests := []struct {
+		name            string
+		ctx             context.Context
+		wantTraceparent string
+		wantTracestate  string
+	}{
+		{"no span", context.Background(), "", ""},
+		{"remote span context", ContextWithRemoteSpanContext(context.Background(), remote), testTraceparent, "rojo=00f067aa0ba902b7"},
+		{"active span", ctx, span.SpanContext().Traceparent(), "rojo=00f067aa0ba902b7"},
+	}
+
+	client := &http.Client{Transport: &TracingTransport{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(tt.ctx, http.MethodGet, server.URL, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if traceparent != tt.wantTraceparent {
+				t.Errorf("traceparent = %q, want %q", traceparent, tt.wantTraceparent)
+			}
+			if tracestate != tt.wantTracestate {
+				t.Errorf("tracestate = %q, want %q", tracestate, tt.wantTracestate)
+			}
+		})
+	}
+
+	if got := span.SpanContext().TraceIDString(); got != testTraceID {
+		t.Errorf("child trace ID = %s, want %s", got, testTraceID)
+	}
+}
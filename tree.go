@@ -20,15 +20,16 @@ type node struct {
 	children  []*node
 	handlers  map[string]HandlerFunc
 	params    []string
+	route     *Route
 }
 
 // addRoute adds a route to the tree
-func (n *node) addRoute(path string, method string, handler HandlerFunc) {
+func (n *node) addRoute(path string, method string, handler HandlerFunc, route *Route) {
 	n.priority++
 
 	// Empty tree
 	if len(n.path) == 0 && len(n.children) == 0 {
-		n.insertChild(path, method, handler)
+		n.insertChild(path, method, handler, route)
 		n.nType = root
 		return
 	}
@@ -49,6 +50,7 @@ walk:
 				handlers:  n.handlers,
 				priority:  n.priority - 1,
 				params:    n.params,
+				route:     n.route,
 			}
 
 			n.children = []*node{&child}
@@ -57,6 +59,7 @@ walk:
 			n.handlers = nil
 			n.wildChild = false
 			n.params = nil
+			n.route = nil
 		}
 
 		// Make new node a child of this node
@@ -82,7 +85,7 @@ walk:
 				n = child
 			}
 
-			n.insertChild(path, method, handler)
+			n.insertChild(path, method, handler, route)
 			return
 		}
 
@@ -91,12 +94,13 @@ walk:
 			n.handlers = make(map[string]HandlerFunc)
 		}
 		n.handlers[method] = handler
+		n.route = route
 		return
 	}
 }
 
 // insertChild inserts a child node
-func (n *node) insertChild(path, method string, handler HandlerFunc) {
+func (n *node) insertChild(path, method string, handler HandlerFunc, route *Route) {
 	for {
 		// Find prefix until first wildcard
 		wildcard, i, valid := findWildcard(path)
@@ -152,6 +156,7 @@ func (n *node) insertChild(path, method string, handler HandlerFunc) {
 				n.handlers = make(map[string]HandlerFunc)
 			}
 			n.handlers[method] = handler
+			n.route = route
 			n.params = append(n.params, wildcard[1:]) // Remove ':'
 			return
 
@@ -190,6 +195,7 @@ func (n *node) insertChild(path, method string, handler HandlerFunc) {
 				priority: 1,
 			}
 			child.handlers[method] = handler
+			child.route = route
 			child.params = append(child.params, wildcard[1:]) // Remove '*'
 			n.children = []*node{child}
 
@@ -203,10 +209,11 @@ func (n *node) insertChild(path, method string, handler HandlerFunc) {
 		n.handlers = make(map[string]HandlerFunc)
 	}
 	n.handlers[method] = handler
+	n.route = route
 }
 
-// getValue returns the handler and params for a given path
-func (n *node) getValue(path, method string) (handler HandlerFunc, params map[string]string) {
+// getValue returns the handler, params and registered route for a given path
+func (n *node) getValue(path, method string) (handler HandlerFunc, params map[string]string, route *Route) {
 	params = make(map[string]string)
 
 walk:
@@ -228,7 +235,7 @@ walk:
 					}
 
 					// Nothing found
-					return nil, nil
+					return nil, nil, nil
 				}
 
 				// Handle wildcard child
@@ -255,24 +262,24 @@ walk:
 						}
 
 						// ... but we can't
-						return nil, nil
+						return nil, nil, nil
 					}
 
 					if handler := n.handlers[method]; handler != nil {
-						return handler, params
+						return handler, params, n.route
 					}
 
 					if len(n.children) == 0 {
-						return nil, nil
+						return nil, nil, nil
 					}
 
 					// Check for handle on the current node
 					n = n.children[0]
 					if handler := n.handlers[method]; handler != nil {
-						return handler, params
+						return handler, params, n.route
 					}
 
-					return nil, nil
+					return nil, nil, nil
 
 				case catchAll:
 					// Save param value
@@ -281,9 +288,9 @@ walk:
 					}
 
 					if handler := n.handlers[method]; handler != nil {
-						return handler, params
+						return handler, params, n.route
 					}
-					return nil, nil
+					return nil, nil, nil
 
 				default:
 					panic("invalid node type")
@@ -292,14 +299,14 @@ walk:
 		} else if path == prefix {
 			// We should have reached the node containing the handler
 			if handler := n.handlers[method]; handler != nil {
-				return handler, params
+				return handler, params, n.route
 			}
 
-			return nil, nil
+			return nil, nil, nil
 		}
 
 		// Nothing found
-		return nil, nil
+		return nil, nil, nil
 	}
 }
 